@@ -0,0 +1,80 @@
+package inspect
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Describe returns a description of a value including the types and the content of all its fields, exported or not.
+// Two values get the same description if they have the same type and content, so it can identify opaque values such
+// as bigtable.ReadOption or bigtable.Filter.
+func Describe(v interface{}) string {
+	var b strings.Builder
+	describe(&b, reflect.ValueOf(v))
+	return b.String()
+}
+
+func describe(b *strings.Builder, v reflect.Value) {
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		describe(b, v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteByte('&')
+		describe(b, v.Elem())
+	case reflect.Struct:
+		b.WriteString(v.Type().String())
+		b.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(v.Type().Field(i).Name)
+			b.WriteByte(':')
+			describe(b, v.Field(i))
+		}
+		b.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		b.WriteString(v.Type().String())
+		b.WriteByte('{')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			describe(b, v.Index(i))
+		}
+		b.WriteByte('}')
+	default:
+		b.WriteString(v.Type().String())
+		b.WriteByte('(')
+		b.WriteString(scalar(v))
+		b.WriteByte(')')
+	}
+}
+
+// scalar formats the values that have no field nor element.
+func scalar(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	default:
+		// maps, channels and functions are not found in the options of the Big Table client
+		return v.Kind().String()
+	}
+}
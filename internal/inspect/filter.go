@@ -0,0 +1,162 @@
+package inspect
+
+import (
+	"reflect"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+)
+
+const bigtablePkgPath = "cloud.google.com/go/bigtable"
+
+// FilterProto returns the protocol buffer the Big Table client sends for a filter. A nil filter gives a nil protocol buffer.
+func FilterProto(f bigtable.Filter) (*btpb.RowFilter, error) {
+	return filterProto(reflect.ValueOf(f))
+}
+
+// ReadOptions returns the filter and the limit of rows set by read options. The limit is zero if there is none.
+func ReadOptions(opts []bigtable.ReadOption) (*btpb.RowFilter, int64, error) {
+	var filter *btpb.RowFilter
+	var limit int64
+	for _, opt := range opts {
+		v := reflect.ValueOf(opt)
+		if v.Type().PkgPath() != bigtablePkgPath {
+			return nil, 0, errors.Errorf("unsupported read option %T", opt)
+		}
+		switch v.Type().Name() {
+		case "rowFilter":
+			f, err := filterProto(v.Field(0))
+			if err != nil {
+				return nil, 0, err
+			}
+			filter = f
+		case "limitRows":
+			limit = v.Field(0).Int()
+		default:
+			return nil, 0, errors.Errorf("unsupported read option %T", opt)
+		}
+	}
+	return filter, limit, nil
+}
+
+// ReadModifyWriteRules returns the protocol buffers of the rules contained in a ReadModifyWrite. It returns an error if
+// the rules can't be read from the version of the client in use.
+func ReadModifyWriteRules(m *bigtable.ReadModifyWrite) ([]*btpb.ReadModifyWriteRule, error) {
+	if m == nil {
+		return nil, nil
+	}
+	v, err := field(reflect.ValueOf(m).Elem(), "ops")
+	if err != nil {
+		return nil, err
+	}
+	rules, ok := v.([]*btpb.ReadModifyWriteRule)
+	if !ok {
+		return nil, errors.Errorf("unsupported rules %T in bigtable.ReadModifyWrite", v)
+	}
+	return rules, nil
+}
+
+// filterProto mirrors the proto methods of the filters of the Big Table client, which are unexported.
+func filterProto(v reflect.Value) (*btpb.RowFilter, error) {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Type().PkgPath() != bigtablePkgPath {
+		return nil, errors.Errorf("unsupported filter %s", v.Type())
+	}
+	switch v.Type().Name() {
+	case "chainFilter", "interleaveFilter":
+		sub := v.Field(0)
+		filters := make([]*btpb.RowFilter, sub.Len())
+		for i := range filters {
+			f, err := filterProto(sub.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			filters[i] = f
+		}
+		if v.Type().Name() == "chainFilter" {
+			return &btpb.RowFilter{Filter: &btpb.RowFilter_Chain_{Chain: &btpb.RowFilter_Chain{Filters: filters}}}, nil
+		}
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_Interleave_{Interleave: &btpb.RowFilter_Interleave{Filters: filters}}}, nil
+	case "conditionFilter":
+		predicate, err := filterProto(v.Field(0))
+		if err != nil {
+			return nil, err
+		}
+		trueFilter, err := filterProto(v.Field(1))
+		if err != nil {
+			return nil, err
+		}
+		falseFilter, err := filterProto(v.Field(2))
+		if err != nil {
+			return nil, err
+		}
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_Condition_{Condition: &btpb.RowFilter_Condition{
+			PredicateFilter: predicate,
+			TrueFilter:      trueFilter,
+			FalseFilter:     falseFilter,
+		}}}, nil
+	case "rowKeyFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_RowKeyRegexFilter{RowKeyRegexFilter: []byte(v.String())}}, nil
+	case "familyFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_FamilyNameRegexFilter{FamilyNameRegexFilter: v.String()}}, nil
+	case "columnFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_ColumnQualifierRegexFilter{ColumnQualifierRegexFilter: []byte(v.String())}}, nil
+	case "valueFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_ValueRegexFilter{ValueRegexFilter: []byte(v.String())}}, nil
+	case "latestNFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_CellsPerColumnLimitFilter{CellsPerColumnLimitFilter: int32(v.Int())}}, nil
+	case "labelFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_ApplyLabelTransformer{ApplyLabelTransformer: v.String()}}, nil
+	case "stripValueFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_StripValueTransformer{StripValueTransformer: true}}, nil
+	case "timestampRangeFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_TimestampRangeFilter{TimestampRangeFilter: &btpb.TimestampRange{
+			StartTimestampMicros: int64(bigtable.Timestamp(v.Field(0).Int()).TruncateToMilliseconds()),
+			EndTimestampMicros:   int64(bigtable.Timestamp(v.Field(1).Int()).TruncateToMilliseconds()),
+		}}}, nil
+	case "columnRangeFilter":
+		r := &btpb.ColumnRange{FamilyName: v.Field(0).String()}
+		if start := v.Field(1).String(); start != "" {
+			r.StartQualifier = &btpb.ColumnRange_StartQualifierClosed{StartQualifierClosed: []byte(start)}
+		}
+		if end := v.Field(2).String(); end != "" {
+			r.EndQualifier = &btpb.ColumnRange_EndQualifierOpen{EndQualifierOpen: []byte(end)}
+		}
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_ColumnRangeFilter{ColumnRangeFilter: r}}, nil
+	case "valueRangeFilter":
+		r := &btpb.ValueRange{}
+		if !v.Field(0).IsNil() {
+			r.StartValue = &btpb.ValueRange_StartValueClosed{StartValueClosed: byteSlice(v.Field(0))}
+		}
+		if !v.Field(1).IsNil() {
+			r.EndValue = &btpb.ValueRange_EndValueOpen{EndValueOpen: byteSlice(v.Field(1))}
+		}
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_ValueRangeFilter{ValueRangeFilter: r}}, nil
+	case "cellsPerRowOffsetFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_CellsPerRowOffsetFilter{CellsPerRowOffsetFilter: int32(v.Int())}}, nil
+	case "cellsPerRowLimitFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_CellsPerRowLimitFilter{CellsPerRowLimitFilter: int32(v.Int())}}, nil
+	case "rowSampleFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_RowSampleFilter{RowSampleFilter: v.Float()}}, nil
+	case "passAllFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_PassAllFilter{PassAllFilter: true}}, nil
+	case "blockAllFilter":
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_BlockAllFilter{BlockAllFilter: true}}, nil
+	}
+	return nil, errors.Errorf("unsupported filter %s", v.Type())
+}
+
+// byteSlice copies a []byte that may be read from an unexported field.
+func byteSlice(v reflect.Value) []byte {
+	b := make([]byte, v.Len())
+	for i := range b {
+		b[i] = byte(v.Index(i).Uint())
+	}
+	return b
+}
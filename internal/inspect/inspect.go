@@ -0,0 +1,45 @@
+/*
+Package inspect gives access to the content of the opaque values of the Big Table client, such as bigtable.Mutation.
+
+The Big Table client keeps the protocol buffers it sends to the server in unexported fields. The adapters of the library
+need to read them to count, record or apply the operations by themselves, so this package reads those fields by reflection.
+It only reads them and never modifies them, and returns an error when they can't be read from the version of the
+client in use rather than empty values, so that the adapters fail instead of silently ignoring the operations.
+*/
+package inspect
+
+import (
+	"reflect"
+	"unsafe"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+)
+
+// MutationOps returns the protocol buffers of the operations contained in a mutation.
+// A conditional mutation has no operation of its own. It returns an error if the operations can't be read from the
+// version of the client in use.
+func MutationOps(m *bigtable.Mutation) ([]*btpb.Mutation, error) {
+	if m == nil {
+		return nil, nil
+	}
+	v, err := field(reflect.ValueOf(m).Elem(), "ops")
+	if err != nil {
+		return nil, err
+	}
+	ops, ok := v.([]*btpb.Mutation)
+	if !ok {
+		return nil, errors.Errorf("unsupported operations %T in bigtable.Mutation", v)
+	}
+	return ops, nil
+}
+
+// field returns the value of an unexported field of an addressable struct.
+func field(v reflect.Value, name string) (interface{}, error) {
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		return nil, errors.Errorf("%s has no field %q", v.Type(), name)
+	}
+	return reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Interface(), nil // #nosec G103 -- read-only access to the fields of the Big Table client
+}
@@ -0,0 +1,112 @@
+package inspect
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/bigtable"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMutationOps(t *testing.T) {
+	m := bigtable.NewMutation()
+	m.Set("front", "e", bigtable.Timestamp(1000), []byte("11"))
+	m.DeleteCellsInFamily("blog")
+	ops, err := MutationOps(m)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(ops) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(ops))
+	}
+	set := ops[0].GetSetCell()
+	if set == nil || set.FamilyName != "front" || string(set.ColumnQualifier) != "e" || string(set.Value) != "11" || set.TimestampMicros != 1000 {
+		t.Fatalf("unexpected operation %v", ops[0])
+	}
+	if del := ops[1].GetDeleteFromFamily(); del == nil || del.FamilyName != "blog" {
+		t.Fatalf("unexpected operation %v", ops[1])
+	}
+	if ops, err = MutationOps(nil); ops != nil || err != nil {
+		t.Fatal("a nil mutation has no operation")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	column := Describe(bigtable.RowFilter(bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.LatestNFilter(1))))
+	value := Describe(bigtable.RowFilter(bigtable.ChainFilters(bigtable.ValueFilter("e"), bigtable.LatestNFilter(1))))
+	if column == value {
+		t.Fatalf("expected different descriptions for different filters, got %s", column)
+	}
+	if column != Describe(bigtable.RowFilter(bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.LatestNFilter(1)))) {
+		t.Fatal("expected the same description for the same filters")
+	}
+	if Describe(bigtable.LimitRows(3)) == Describe(bigtable.LimitRows(4)) {
+		t.Fatal("expected different descriptions for different limits")
+	}
+}
+
+func TestFilterProto(t *testing.T) {
+	filter := bigtable.ChainFilters(
+		bigtable.FamilyFilter("front"),
+		bigtable.InterleaveFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("1")),
+		bigtable.TimestampRangeFilterMicros(1500, 4000),
+		bigtable.ValueRangeFilter([]byte("a"), nil),
+		bigtable.ConditionFilter(bigtable.LatestNFilter(1), bigtable.StripValueFilter(), nil),
+	)
+	got, err := FilterProto(filter)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := &btpb.RowFilter{Filter: &btpb.RowFilter_Chain_{Chain: &btpb.RowFilter_Chain{Filters: []*btpb.RowFilter{
+		{Filter: &btpb.RowFilter_FamilyNameRegexFilter{FamilyNameRegexFilter: "front"}},
+		{Filter: &btpb.RowFilter_Interleave_{Interleave: &btpb.RowFilter_Interleave{Filters: []*btpb.RowFilter{
+			{Filter: &btpb.RowFilter_ColumnQualifierRegexFilter{ColumnQualifierRegexFilter: []byte("e")}},
+			{Filter: &btpb.RowFilter_ValueRegexFilter{ValueRegexFilter: []byte("1")}},
+		}}}},
+		{Filter: &btpb.RowFilter_TimestampRangeFilter{TimestampRangeFilter: &btpb.TimestampRange{StartTimestampMicros: 1000, EndTimestampMicros: 4000}}},
+		{Filter: &btpb.RowFilter_ValueRangeFilter{ValueRangeFilter: &btpb.ValueRange{StartValue: &btpb.ValueRange_StartValueClosed{StartValueClosed: []byte("a")}}}},
+		{Filter: &btpb.RowFilter_Condition_{Condition: &btpb.RowFilter_Condition{
+			PredicateFilter: &btpb.RowFilter{Filter: &btpb.RowFilter_CellsPerColumnLimitFilter{CellsPerColumnLimitFilter: 1}},
+			TrueFilter:      &btpb.RowFilter{Filter: &btpb.RowFilter_StripValueTransformer{StripValueTransformer: true}},
+		}}},
+	}}}}
+	if !proto.Equal(got, expected) {
+		t.Fatalf("unexpected filter %v", got)
+	}
+}
+
+func TestReadOptions(t *testing.T) {
+	filter, limit, err := ReadOptions([]bigtable.ReadOption{bigtable.RowFilter(bigtable.PassAllFilter()), bigtable.LimitRows(3)})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if filter.GetPassAllFilter() != true || limit != 3 {
+		t.Fatalf("unexpected options %v %d", filter, limit)
+	}
+	if filter, limit, err = ReadOptions(nil); filter != nil || limit != 0 || err != nil {
+		t.Fatalf("expected no option, got %v %d %v", filter, limit, err)
+	}
+}
+
+func TestReadModifyWriteRules(t *testing.T) {
+	m := bigtable.NewReadModifyWrite()
+	m.Increment("front", "c", 2)
+	rules, err := ReadModifyWriteRules(m)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(rules) != 1 || rules[0].FamilyName != "front" || rules[0].GetIncrementAmount() != 2 {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+}
+
+func TestField(t *testing.T) {
+	v := reflect.ValueOf(bigtable.NewMutation()).Elem()
+	if _, err := field(v, "ops"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := field(v, "renamed"); err == nil {
+		t.Fatal("expected an error for a missing field")
+	}
+}
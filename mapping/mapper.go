@@ -1,6 +1,7 @@
 package mapping
 
 import (
+	"sort"
 	"strings"
 
 	"cloud.google.com/go/bigtable"
@@ -78,6 +79,59 @@ func (m *Mapper) GetMutations(eventSet *data.Set) map[string]*bigtable.Mutation
 	return mutations
 }
 
+// GetDeleteMutations builds, for each row key, the mutation that deletes the cells of the events contained in the data.Set.
+// Each cell is identified by its mapped column and the timestamp of its event, so the other events of the row are kept.
+func (m *Mapper) GetDeleteMutations(eventSet *data.Set) map[string]*bigtable.Mutation {
+	mutations := make(map[string]*bigtable.Mutation)
+	for family, events := range eventSet.Events {
+		for _, event := range events {
+			if _, ok := mutations[event.RowKey]; !ok {
+				mutations[event.RowKey] = bigtable.NewMutation()
+			}
+			// Big Table works at the millisecond granularity, the range covers the whole millisecond of the event
+			start := bigtable.Time(event.Date).TruncateToMilliseconds()
+			for name, value := range event.Cells {
+				btName, _ := getMappedData(m.Mapping, m.rules.toBigTable, name, value)
+				mutations[event.RowKey].DeleteTimestampRange(family, btName, start, start+1000)
+			}
+		}
+	}
+	return mutations
+}
+
+// ToBigTable translates a mapped column and its value into the column qualifier and the value stored in Big Table,
+// the same way GetMutations does. Columns that are not part of the mapping are returned unchanged.
+func (m *Mapper) ToBigTable(column string, value string) (string, string) {
+	return getMappedData(m.Mapping, m.rules.toBigTable, column, value)
+}
+
+// ShortColumns returns the column qualifiers used in Big Table to store the given mapped column: the short column for
+// columns from the "raws" and "mapped" sections, and one column per value for the columns from the "reversed" section.
+// The returned boolean is false when the column is not part of the mapping.
+func (m *Mapper) ShortColumns(column string) ([]string, bool) {
+	for short, full := range m.Raws {
+		if full == column {
+			return []string{short}, true
+		}
+	}
+	for short, rule := range m.Mapped {
+		if rule.Name == column {
+			return []string{short}, true
+		}
+	}
+	for _, reversed := range m.Reversed {
+		if reversed.Name == column {
+			columns := make([]string, 0, len(reversed.Values))
+			for short := range reversed.Values {
+				columns = append(columns, short)
+			}
+			sort.Strings(columns)
+			return columns, true
+		}
+	}
+	return nil, false
+}
+
 // getMappedData uses all `rules` to find the appropriate mapping method and return the mapped column + value.
 func getMappedData(mapping *Mapping, rules []func(m *Mapping, column string, value string) (bool, string, string), column string, value string) (string, string) {
 	for _, seek := range rules {
@@ -335,3 +335,88 @@ func TestMapper_GetMutations(t *testing.T) {
 		}
 	}
 }
+
+func TestMapper_GetDeleteMutations(t *testing.T) {
+	eventSet := data.Set{
+		Events: map[string][]*data.Event{
+			"front": {
+				{
+					RowKey: "contact-1",
+					Date:   time.Now(),
+					Cells: map[string]string{
+						"user_id":      "12",
+						"order_status": "processing",
+					},
+				},
+				{
+					RowKey: "contact-2",
+					Date:   time.Now(),
+					Cells: map[string]string{
+						"is_opted_in": "true",
+					},
+				},
+			},
+		},
+	}
+
+	mapping, err := LoadMappingFromFile("./testdata/mapping.json")
+	if err != nil {
+		log.Println(err)
+		t.Fatal("should not raise an error")
+	}
+	mapper := NewMapper(mapping)
+	mutations := mapper.GetDeleteMutations(&eventSet)
+
+	if len(mutations) != 2 {
+		t.Fatalf("wrong number of mutations, should have two got : %v", len(mutations))
+	}
+	for _, key := range []string{"contact-1", "contact-2"} {
+		if _, ok := mutations[key]; !ok {
+			t.Fatalf("missing mutation for %s", key)
+		}
+	}
+}
+
+func TestMapper_ToBigTable(t *testing.T) {
+	mapping, err := LoadMappingFromFile("./testdata/mapping.json")
+	if err != nil {
+		log.Println(err)
+		t.Fatal("should not raise an error")
+	}
+	mapper := NewMapper(mapping)
+	cases := []struct {
+		column, value, wantedCol, wantedVal string
+	}{
+		{"user_id", "1233", "ui", "1233"},
+		{"is_opted_in", "true", "oi", "1"},
+		{"order_status", "processing", "3", "1"},
+		{"unknown", "value", "unknown", "value"},
+	}
+	for _, c := range cases {
+		col, val := mapper.ToBigTable(c.column, c.value)
+		if col != c.wantedCol || val != c.wantedVal {
+			t.Fatalf("wrong mapping for %s=%s: wanted %s=%s, got %s=%s", c.column, c.value, c.wantedCol, c.wantedVal, col, val)
+		}
+	}
+}
+
+func TestMapper_ShortColumns(t *testing.T) {
+	mapping, err := LoadMappingFromFile("./testdata/mapping.json")
+	if err != nil {
+		log.Println(err)
+		t.Fatal("should not raise an error")
+	}
+	mapper := NewMapper(mapping)
+	if cols, ok := mapper.ShortColumns("user_id"); !ok || len(cols) != 1 || cols[0] != "ui" {
+		t.Fatalf("expected [ui], got %v", cols)
+	}
+	if cols, ok := mapper.ShortColumns("is_opted_in"); !ok || len(cols) != 1 || cols[0] != "oi" {
+		t.Fatalf("expected [oi], got %v", cols)
+	}
+	if cols, ok := mapper.ShortColumns("order_status"); !ok || len(cols) != 7 || cols[0] != "1" {
+		t.Fatalf("expected 7 columns, got %v", cols)
+	}
+	if _, ok := mapper.ShortColumns("unknown"); ok {
+		t.Fatal("unknown column should not be found")
+	}
+}
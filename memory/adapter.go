@@ -0,0 +1,612 @@
+/*
+Package memory provides an in-memory implementation of repository.Adapter, to run the code using a repository.Repository
+without Big Table nor its emulator.
+
+	repo := repository.NewRepositoryWithAdapter(memory.NewAdapter(), mapper)
+
+The adapter stores the cells in Go maps and evaluates the filters of the Big Table client the way Big Table does:
+family, column and value regular expressions and ranges, timestamp ranges, latest N cells, cells per row limit and
+offset, chains, interleaves, conditions, labels and stripped values. The rows are returned ordered by key.
+
+Its tables have no schema, so any column family can be written. The column families of a row are ordered by name
+whereas Big Table orders them as declared in the schema: it only matters to the filters limiting or skipping cells per
+row across several families.
+*/
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/internal/inspect"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Adapter is an in-memory table implementing repository.Adapter. It is safe for concurrent use.
+type Adapter struct {
+	mu     sync.Mutex
+	rows   map[string]map[string]map[string][]value
+	now    func() time.Time
+	random func() float64
+}
+
+// value is a version of a cell, the versions of a column being sorted from the most recent to the oldest.
+type value struct {
+	ts    int64
+	value []byte
+}
+
+// cell is a version of a cell as seen by the filters.
+type cell struct {
+	family, column string
+	ts             int64
+	value          []byte
+	labels         []string
+}
+
+func NewAdapter() *Adapter {
+	return &Adapter{
+		rows:   make(map[string]map[string]map[string][]value),
+		now:    time.Now,
+		random: rand.Float64, // #nosec G404 -- the row sample filter doesn't need a secure random generator
+	}
+}
+
+func (a *Adapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filter, _, err := inspect.ReadOptions(opts)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.read(row, filter)
+}
+
+func (a *Adapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	filter, limit, err := inspect.ReadOptions(opts)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	a.mu.Lock()
+	keys := make([]string, 0, len(a.rows))
+	for key := range a.rows {
+		contains, err := rowSetContains(arg, key)
+		if err != nil {
+			a.mu.Unlock()
+			return err
+		}
+		if contains {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var rows []bigtable.Row
+	for _, key := range keys {
+		if limit > 0 && int64(len(rows)) == limit {
+			break
+		}
+		row, err := a.read(key, filter)
+		if err != nil {
+			a.mu.Unlock()
+			return err
+		}
+		if row != nil {
+			rows = append(rows, row)
+		}
+	}
+	// the callback is called without the lock, so it can use the adapter
+	a.mu.Unlock()
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !f(row) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (a *Adapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, _ ...bigtable.ApplyOption) (errs []error, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(rowKeys) != len(muts) {
+		return nil, status.Errorf(codes.InvalidArgument, "mismatched rowKeys and mutation array lengths: %d, %d", len(rowKeys), len(muts))
+	}
+	ops := make([][]*btpb.Mutation, len(muts))
+	for i, mut := range muts {
+		if ops[i], err = inspect.MutationOps(mut); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	failed := false
+	errs = make([]error, len(rowKeys))
+	for i, key := range rowKeys {
+		if errs[i] = a.mutate(key, ops[i]); errs[i] != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		return nil, nil
+	}
+	return errs, nil
+}
+
+func (a *Adapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	filter, err := inspect.FilterProto(cond)
+	if err != nil {
+		return false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	trueOps, err := inspect.MutationOps(mtrue)
+	if err != nil {
+		return false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	falseOps, err := inspect.MutationOps(mfalse)
+	if err != nil {
+		return false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cells, err := a.filter(row, filter)
+	if err != nil {
+		return false, err
+	}
+	matched = len(cells) > 0
+	ops := falseOps
+	if matched {
+		ops = trueOps
+	}
+	return matched, a.mutate(row, ops)
+}
+
+func (a *Adapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rules, err := inspect.ReadModifyWriteRules(m)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// the rules are checked first, as a failed rule must not leave the row modified
+	updates := make([]*btpb.Mutation_SetCell, 0, len(rules))
+	result := make(bigtable.Row)
+	for _, rule := range rules {
+		column := string(rule.ColumnQualifier)
+		var latest value
+		if versions := a.rows[row][rule.FamilyName][column]; len(versions) > 0 {
+			latest = versions[0]
+		}
+		// a rule applying to a column updated by a previous rule sees the new value
+		for _, update := range updates {
+			if update.FamilyName == rule.FamilyName && string(update.ColumnQualifier) == column {
+				latest = value{ts: update.TimestampMicros, value: update.Value}
+			}
+		}
+		var newValue []byte
+		switch r := rule.Rule.(type) {
+		case *btpb.ReadModifyWriteRule_AppendValue:
+			newValue = append(append([]byte(nil), latest.value...), r.AppendValue...)
+		case *btpb.ReadModifyWriteRule_IncrementAmount:
+			var current int64
+			if latest.value != nil {
+				if len(latest.value) != 8 {
+					return nil, status.Errorf(codes.InvalidArgument, "increment on a value of %d bytes in %s:%s", len(latest.value), rule.FamilyName, column)
+				}
+				current = int64(binary.BigEndian.Uint64(latest.value))
+			}
+			newValue = make([]byte, 8)
+			binary.BigEndian.PutUint64(newValue, uint64(current+r.IncrementAmount))
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported rule %T", rule.Rule)
+		}
+		ts := a.serverTime()
+		if latest.ts > ts {
+			ts = latest.ts
+		}
+		updates = append(updates, &btpb.Mutation_SetCell{FamilyName: rule.FamilyName, ColumnQualifier: rule.ColumnQualifier, TimestampMicros: ts, Value: newValue})
+	}
+	for _, update := range updates {
+		a.setCell(row, update)
+		item := bigtable.ReadItem{Row: row, Column: update.FamilyName + ":" + string(update.ColumnQualifier), Timestamp: bigtable.Timestamp(update.TimestampMicros), Value: update.Value}
+		items := result[update.FamilyName]
+		replaced := false
+		for i := range items {
+			if items[i].Column == item.Column {
+				items[i], replaced = item, true
+			}
+		}
+		if !replaced {
+			result[update.FamilyName] = append(items, item)
+		}
+	}
+	return result, nil
+}
+
+// read returns the cells of a row matching the filter, or nil if there is none. It must be called with the lock held.
+func (a *Adapter) read(key string, filter *btpb.RowFilter) (bigtable.Row, error) {
+	cells, err := a.filter(key, filter)
+	if err != nil || len(cells) == 0 {
+		return nil, err
+	}
+	row := make(bigtable.Row)
+	for _, c := range cells {
+		row[c.family] = append(row[c.family], bigtable.ReadItem{
+			Row:       key,
+			Column:    c.family + ":" + c.column,
+			Timestamp: bigtable.Timestamp(c.ts),
+			Value:     c.value,
+			Labels:    c.labels,
+		})
+	}
+	return row, nil
+}
+
+// filter returns the cells of a row matching the filter. It must be called with the lock held.
+func (a *Adapter) filter(key string, filter *btpb.RowFilter) ([]cell, error) {
+	families := a.rows[key]
+	var cells []cell
+	for _, family := range sortedFamilies(families) {
+		columns := families[family]
+		for _, column := range sortedColumns(columns) {
+			for _, v := range columns[column] {
+				cells = append(cells, cell{family: family, column: column, ts: v.ts, value: v.value})
+			}
+		}
+	}
+	return a.apply(filter, key, cells)
+}
+
+// apply evaluates a filter on the cells of a row, sorted by family, column and descending timestamp.
+func (a *Adapter) apply(f *btpb.RowFilter, key string, cells []cell) ([]cell, error) {
+	if f == nil || len(cells) == 0 {
+		return cells, nil
+	}
+	switch f := f.Filter.(type) {
+	case *btpb.RowFilter_PassAllFilter:
+		return cells, nil
+	case *btpb.RowFilter_BlockAllFilter:
+		return nil, nil
+	case *btpb.RowFilter_Chain_:
+		var err error
+		for _, sub := range f.Chain.Filters {
+			if cells, err = a.apply(sub, key, cells); err != nil {
+				return nil, err
+			}
+		}
+		return cells, nil
+	case *btpb.RowFilter_Interleave_:
+		var result []cell
+		for _, sub := range f.Interleave.Filters {
+			subCells, err := a.apply(sub, key, cells)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, subCells...)
+		}
+		sort.SliceStable(result, func(i, j int) bool {
+			if result[i].family != result[j].family {
+				return result[i].family < result[j].family
+			}
+			if result[i].column != result[j].column {
+				return result[i].column < result[j].column
+			}
+			return result[i].ts > result[j].ts
+		})
+		return result, nil
+	case *btpb.RowFilter_Condition_:
+		matched, err := a.apply(f.Condition.PredicateFilter, key, cells)
+		if err != nil {
+			return nil, err
+		}
+		next := f.Condition.FalseFilter
+		if len(matched) > 0 {
+			next = f.Condition.TrueFilter
+		}
+		if next == nil {
+			return nil, nil
+		}
+		return a.apply(next, key, cells)
+	case *btpb.RowFilter_RowKeyRegexFilter:
+		rx, err := compile(string(f.RowKeyRegexFilter))
+		if err != nil {
+			return nil, err
+		}
+		if !rx.MatchString(key) {
+			return nil, nil
+		}
+		return cells, nil
+	case *btpb.RowFilter_RowSampleFilter:
+		if a.random() < f.RowSampleFilter {
+			return cells, nil
+		}
+		return nil, nil
+	case *btpb.RowFilter_CellsPerColumnLimitFilter:
+		var result []cell
+		count := 0
+		for i, c := range cells {
+			if i == 0 || c.family != cells[i-1].family || c.column != cells[i-1].column {
+				count = 0
+			}
+			if count < int(f.CellsPerColumnLimitFilter) {
+				result = append(result, c)
+			}
+			count++
+		}
+		return result, nil
+	case *btpb.RowFilter_CellsPerRowLimitFilter:
+		if limit := int(f.CellsPerRowLimitFilter); len(cells) > limit {
+			return cells[:limit], nil
+		}
+		return cells, nil
+	case *btpb.RowFilter_CellsPerRowOffsetFilter:
+		if offset := int(f.CellsPerRowOffsetFilter); len(cells) > offset {
+			return cells[offset:], nil
+		}
+		return nil, nil
+	case *btpb.RowFilter_StripValueTransformer:
+		result := make([]cell, len(cells))
+		for i, c := range cells {
+			c.value = nil
+			result[i] = c
+		}
+		return result, nil
+	case *btpb.RowFilter_ApplyLabelTransformer:
+		result := make([]cell, len(cells))
+		for i, c := range cells {
+			c.labels = append(append([]string(nil), c.labels...), f.ApplyLabelTransformer)
+			result[i] = c
+		}
+		return result, nil
+	}
+	include, err := cellFilter(f)
+	if err != nil {
+		return nil, err
+	}
+	var result []cell
+	for _, c := range cells {
+		if include(c) {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// cellFilter returns a function telling whether a cell matches a filter applying to each cell on its own.
+func cellFilter(f *btpb.RowFilter) (func(c cell) bool, error) {
+	switch f := f.Filter.(type) {
+	case *btpb.RowFilter_FamilyNameRegexFilter:
+		rx, err := compile(f.FamilyNameRegexFilter)
+		if err != nil {
+			return nil, err
+		}
+		return func(c cell) bool { return rx.MatchString(c.family) }, nil
+	case *btpb.RowFilter_ColumnQualifierRegexFilter:
+		rx, err := compile(string(f.ColumnQualifierRegexFilter))
+		if err != nil {
+			return nil, err
+		}
+		return func(c cell) bool { return rx.MatchString(c.column) }, nil
+	case *btpb.RowFilter_ValueRegexFilter:
+		rx, err := compile(string(f.ValueRegexFilter))
+		if err != nil {
+			return nil, err
+		}
+		return func(c cell) bool { return rx.Match(c.value) }, nil
+	case *btpb.RowFilter_TimestampRangeFilter:
+		start, end := f.TimestampRangeFilter.StartTimestampMicros, f.TimestampRangeFilter.EndTimestampMicros
+		// the start is inclusive, the end is exclusive and zero means infinity
+		return func(c cell) bool { return c.ts >= start && (end == 0 || c.ts < end) }, nil
+	case *btpb.RowFilter_ColumnRangeFilter:
+		r := f.ColumnRangeFilter
+		return func(c cell) bool {
+			if c.family != r.FamilyName {
+				return false
+			}
+			column := []byte(c.column)
+			switch start := r.StartQualifier.(type) {
+			case *btpb.ColumnRange_StartQualifierClosed:
+				if bytes.Compare(column, start.StartQualifierClosed) < 0 {
+					return false
+				}
+			case *btpb.ColumnRange_StartQualifierOpen:
+				if bytes.Compare(column, start.StartQualifierOpen) <= 0 {
+					return false
+				}
+			}
+			switch end := r.EndQualifier.(type) {
+			case *btpb.ColumnRange_EndQualifierClosed:
+				return bytes.Compare(column, end.EndQualifierClosed) <= 0
+			case *btpb.ColumnRange_EndQualifierOpen:
+				return bytes.Compare(column, end.EndQualifierOpen) < 0
+			}
+			return true
+		}, nil
+	case *btpb.RowFilter_ValueRangeFilter:
+		r := f.ValueRangeFilter
+		return func(c cell) bool {
+			switch start := r.StartValue.(type) {
+			case *btpb.ValueRange_StartValueClosed:
+				if bytes.Compare(c.value, start.StartValueClosed) < 0 {
+					return false
+				}
+			case *btpb.ValueRange_StartValueOpen:
+				if bytes.Compare(c.value, start.StartValueOpen) <= 0 {
+					return false
+				}
+			}
+			switch end := r.EndValue.(type) {
+			case *btpb.ValueRange_EndValueClosed:
+				return bytes.Compare(c.value, end.EndValueClosed) <= 0
+			case *btpb.ValueRange_EndValueOpen:
+				return bytes.Compare(c.value, end.EndValueOpen) < 0
+			}
+			return true
+		}, nil
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "unsupported filter %T", f.Filter)
+}
+
+// mutate applies the operations of a mutation to a row. It must be called with the lock held.
+func (a *Adapter) mutate(key string, ops []*btpb.Mutation) error {
+	for _, op := range ops {
+		switch m := op.Mutation.(type) {
+		case *btpb.Mutation_SetCell_:
+		case *btpb.Mutation_DeleteFromColumn_, *btpb.Mutation_DeleteFromFamily_, *btpb.Mutation_DeleteFromRow_:
+		default:
+			return status.Errorf(codes.InvalidArgument, "unsupported mutation %T", m)
+		}
+	}
+	for _, op := range ops {
+		switch m := op.Mutation.(type) {
+		case *btpb.Mutation_SetCell_:
+			set := &btpb.Mutation_SetCell{
+				FamilyName:      m.SetCell.FamilyName,
+				ColumnQualifier: m.SetCell.ColumnQualifier,
+				TimestampMicros: m.SetCell.TimestampMicros,
+				Value:           m.SetCell.Value,
+			}
+			if set.TimestampMicros == -1 {
+				set.TimestampMicros = a.serverTime()
+			}
+			a.setCell(key, set)
+		case *btpb.Mutation_DeleteFromColumn_:
+			del := m.DeleteFromColumn
+			column := string(del.ColumnQualifier)
+			versions := a.rows[key][del.FamilyName][column]
+			kept := versions[:0]
+			for _, v := range versions {
+				if r := del.TimeRange; r != nil && (v.ts < r.StartTimestampMicros || (r.EndTimestampMicros != 0 && v.ts >= r.EndTimestampMicros)) {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == 0 {
+				delete(a.rows[key][del.FamilyName], column)
+			} else {
+				a.rows[key][del.FamilyName][column] = kept
+			}
+		case *btpb.Mutation_DeleteFromFamily_:
+			delete(a.rows[key], m.DeleteFromFamily.FamilyName)
+		case *btpb.Mutation_DeleteFromRow_:
+			delete(a.rows, key)
+		}
+	}
+	a.prune(key)
+	return nil
+}
+
+// setCell writes a version of a cell, replacing the one with the same timestamp if any.
+func (a *Adapter) setCell(key string, set *btpb.Mutation_SetCell) {
+	families, ok := a.rows[key]
+	if !ok {
+		families = make(map[string]map[string][]value)
+		a.rows[key] = families
+	}
+	columns, ok := families[set.FamilyName]
+	if !ok {
+		columns = make(map[string][]value)
+		families[set.FamilyName] = columns
+	}
+	column := string(set.ColumnQualifier)
+	versions := columns[column]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].ts <= set.TimestampMicros })
+	v := value{ts: set.TimestampMicros, value: append([]byte(nil), set.Value...)}
+	if i < len(versions) && versions[i].ts == set.TimestampMicros {
+		versions[i] = v
+	} else {
+		versions = append(versions, value{})
+		copy(versions[i+1:], versions[i:])
+		versions[i] = v
+	}
+	columns[column] = versions
+}
+
+// prune removes the empty families of a row, and the row if it has no family left.
+func (a *Adapter) prune(key string) {
+	families, ok := a.rows[key]
+	if !ok {
+		return
+	}
+	for family, columns := range families {
+		if len(columns) == 0 {
+			delete(families, family)
+		}
+	}
+	if len(families) == 0 {
+		delete(a.rows, key)
+	}
+}
+
+// serverTime returns the current time with the millisecond granularity of Big Table.
+func (a *Adapter) serverTime() int64 {
+	return int64(bigtable.Time(a.now()).TruncateToMilliseconds())
+}
+
+func rowSetContains(set bigtable.RowSet, key string) (bool, error) {
+	switch s := set.(type) {
+	case bigtable.RowList:
+		// bigtable.SingleRow is a RowList of one key too
+		for _, k := range s {
+			if k == key {
+				return true, nil
+			}
+		}
+		return false, nil
+	case bigtable.RowRange:
+		return s.Contains(key), nil
+	case bigtable.RowRangeList:
+		for _, r := range s {
+			if r.Contains(key) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, status.Errorf(codes.InvalidArgument, "unsupported row set %T", set)
+}
+
+// compile compiles a regular expression of a filter, which has to match the entire value.
+func compile(pattern string) (*regexp.Regexp, error) {
+	rx, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid regular expression %q: %v", pattern, err)
+	}
+	return rx, nil
+}
+
+func sortedFamilies(families map[string]map[string][]value) []string {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedColumns(columns map[string][]value) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,273 @@
+package memory
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/bigtable/bttest"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"github.com/sendinblue/bigtable-access-layer/mapping"
+	"github.com/sendinblue/bigtable-access-layer/repository"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const testMapping = `{
+  "raws": {"u": "url"},
+  "mapped": {
+    "d": {"name": "device_type", "values": {"1": "Smartphone", "2": "Computer"}},
+    "e": {"name": "event_type", "values": {"11": "page_view", "12": "add_to_cart", "13": "purchase"}}
+  }
+}`
+
+// getEmulatorTable opens a table of the Big Table emulator with the front and blog column families.
+func getEmulatorTable(t *testing.T) *bigtable.Table {
+	ctx := context.Background()
+	srv, err := bttest.NewServer("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminClient, err := bigtable.NewAdminClient(ctx, "project", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = adminClient.CreateTable(ctx, "events"); err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range []string{"front", "blog"} {
+		if err = adminClient.CreateColumnFamily(ctx, "events", family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client, err := bigtable.NewClient(ctx, "project", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.Open("events")
+}
+
+// getMutations returns the same rows as the emulator helper of the repository tests, on two column families.
+func getMutations() ([]string, []*bigtable.Mutation) {
+	var keys []string
+	var muts []*bigtable.Mutation
+	for i := 1; i <= 5; i++ {
+		mut := bigtable.NewMutation()
+		for j := 0; j < 10; j++ {
+			ts := bigtable.Timestamp((1000 + j) * 1000)
+			family := "front"
+			if j%3 == 0 {
+				family = "blog"
+			}
+			mut.Set(family, "u", ts, []byte(fmt.Sprintf("https://example.org/%d", j)))
+			mut.Set(family, "e", ts, []byte(fmt.Sprintf("1%d", 1+j%3)))
+			mut.Set(family, "d", ts, []byte(fmt.Sprintf("%d", 1+(i+j)%2)))
+		}
+		keys = append(keys, fmt.Sprintf("contact-%d", i))
+		muts = append(muts, mut)
+	}
+	return keys, muts
+}
+
+func readAll(t *testing.T, adapter repository.Adapter, set bigtable.RowSet, opts ...bigtable.ReadOption) []bigtable.Row {
+	var rows []bigtable.Row
+	err := adapter.ReadRows(context.Background(), set, func(row bigtable.Row) bool {
+		rows = append(rows, row)
+		return true
+	}, opts...)
+	if err != nil {
+		t.Fatalf("failed to read rows: %v", err)
+	}
+	return rows
+}
+
+// TestAdapter_Emulator checks that the adapter returns the same rows as the emulator for the filters used by the library.
+func TestAdapter_Emulator(t *testing.T) {
+	ctx := context.Background()
+	tbl := getEmulatorTable(t)
+	memory := NewAdapter()
+	keys, muts := getMutations()
+	if errs, err := tbl.ApplyBulk(ctx, keys, muts); err != nil || errs != nil {
+		t.Fatalf("failed to write to the emulator: %v %v", err, errs)
+	}
+	if errs, err := memory.ApplyBulk(ctx, keys, muts); err != nil || errs != nil {
+		t.Fatalf("failed to write to the memory: %v %v", err, errs)
+	}
+
+	filters := map[string]bigtable.Filter{
+		"none":      nil,
+		"family":    bigtable.FamilyFilter("front"),
+		"column":    bigtable.ColumnFilter("e"),
+		"value":     bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13")),
+		"timestamp": bigtable.TimestampRangeFilter(time.Unix(1003, 0), time.Unix(1006, 0)),
+		"latest":    bigtable.LatestNFilter(2),
+		"limit":     bigtable.ChainFilters(bigtable.FamilyFilter("blog"), bigtable.CellsPerRowLimitFilter(4)),
+		"strip":     bigtable.ChainFilters(bigtable.FamilyFilter("front"), bigtable.CellsPerRowLimitFilter(1), bigtable.StripValueFilter()),
+		"interleave": bigtable.InterleaveFilters(
+			bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("12"), bigtable.LabelFilter("matched")),
+			bigtable.ColumnFilter("d"),
+		),
+		"condition": bigtable.ConditionFilter(bigtable.ValueFilter("https://example.org/9"), bigtable.FamilyFilter("front"), bigtable.BlockAllFilter()),
+	}
+	sets := map[string]bigtable.RowSet{
+		"prefix": bigtable.PrefixRange("contact-"),
+		"range":  bigtable.NewRange("contact-2", "contact-4"),
+		"list":   bigtable.RowList{"contact-5", "contact-1", "missing"},
+		"single": bigtable.SingleRow("contact-3"),
+	}
+	for filterName, filter := range filters {
+		for setName, set := range sets {
+			var opts []bigtable.ReadOption
+			if filter != nil {
+				opts = append(opts, bigtable.RowFilter(filter))
+			}
+			expected := readAll(t, emulatorAdapter{tbl}, set, opts...)
+			got := readAll(t, memory, set, opts...)
+			if !reflect.DeepEqual(expected, got) {
+				t.Errorf("%s on %s: expected %v, got %v", filterName, setName, expected, got)
+			}
+		}
+	}
+
+	limited := readAll(t, memory, bigtable.PrefixRange("contact-"), bigtable.LimitRows(2), bigtable.RowFilter(bigtable.ColumnFilter("e")))
+	if len(limited) != 2 || limited[0].Key() != "contact-1" || limited[1].Key() != "contact-2" {
+		t.Fatalf("expected the 2 first rows, got %v", limited)
+	}
+	row, err := memory.ReadRow(ctx, "contact-3", bigtable.RowFilter(bigtable.LatestNFilter(1)))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	expected, err := tbl.ReadRow(ctx, "contact-3", bigtable.RowFilter(bigtable.LatestNFilter(1)))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !reflect.DeepEqual(expected, row) {
+		t.Fatalf("expected %v, got %v", expected, row)
+	}
+	if row, err = memory.ReadRow(ctx, "missing"); row != nil || err != nil {
+		t.Fatalf("expected no row, got %v %v", row, err)
+	}
+}
+
+// emulatorAdapter reads from a table of the emulator.
+type emulatorAdapter struct {
+	*bigtable.Table
+}
+
+func (a emulatorAdapter) CheckAndMutate(context.Context, string, bigtable.Filter, *bigtable.Mutation, *bigtable.Mutation) (bool, error) {
+	return false, nil
+}
+
+func TestAdapter_Mutations(t *testing.T) {
+	ctx := context.Background()
+	memory := NewAdapter()
+	keys, muts := getMutations()
+	if _, err := memory.ApplyBulk(ctx, keys, muts); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	del := bigtable.NewMutation()
+	del.DeleteTimestampRange("front", "u", bigtable.Timestamp(1001000), bigtable.Timestamp(1003000))
+	del.DeleteCellsInFamily("blog")
+	if errs, err := memory.ApplyBulk(ctx, []string{"contact-1"}, []*bigtable.Mutation{del}); err != nil || errs != nil {
+		t.Fatalf("failed to delete: %v %v", err, errs)
+	}
+	row, _ := memory.ReadRow(ctx, "contact-1", bigtable.RowFilter(bigtable.ColumnFilter("u")))
+	if len(row["blog"]) != 0 || len(row["front"]) != 4 {
+		t.Fatalf("unexpected row after the deletions %v", row)
+	}
+
+	del = bigtable.NewMutation()
+	del.DeleteRow()
+	if _, err := memory.ApplyBulk(ctx, []string{"contact-1"}, []*bigtable.Mutation{del}); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if row, _ = memory.ReadRow(ctx, "contact-1"); row != nil {
+		t.Fatalf("expected the row to be deleted, got %v", row)
+	}
+
+	set := bigtable.NewMutation()
+	set.Set("front", "e", bigtable.Timestamp(2000000), []byte("13"))
+	matched, err := memory.CheckAndMutate(ctx, "contact-2", bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13")), nil, set)
+	if err != nil || !matched {
+		t.Fatalf("expected the condition to match, got %v %v", matched, err)
+	}
+	if row, _ = memory.ReadRow(ctx, "contact-2", bigtable.RowFilter(bigtable.TimestampRangeFilterMicros(2000000, 0))); row != nil {
+		t.Fatalf("the false mutation should not be applied, got %v", row)
+	}
+
+	rmw := bigtable.NewReadModifyWrite()
+	rmw.Increment("front", "c", 3)
+	rmw.Increment("front", "c", 2)
+	result, err := memory.ApplyReadModifyWrite(ctx, "contact-2", rmw)
+	if err != nil {
+		t.Fatalf("failed to increment: %v", err)
+	}
+	if len(result["front"]) != 1 || binary.BigEndian.Uint64(result["front"][0].Value) != 5 {
+		t.Fatalf("expected a counter of 5, got %v", result)
+	}
+	rmw = bigtable.NewReadModifyWrite()
+	rmw.Increment("front", "u", 1)
+	if _, err = memory.ApplyReadModifyWrite(ctx, "contact-2", rmw); err == nil {
+		t.Fatal("expected an error when incrementing a value that isn't a counter")
+	}
+}
+
+func TestAdapter_Repository(t *testing.T) {
+	ctx := context.Background()
+	jsonMapping, err := mapping.LoadMapping([]byte(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewRepositoryWithAdapter(NewAdapter(), mapping.NewMapper(jsonMapping))
+	date := time.Unix(1000, 0)
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "contact-1", Date: date, Cells: map[string]string{"event_type": "purchase", "device_type": "Computer"}},
+			{RowKey: "contact-1", Date: date.Add(time.Second), Cells: map[string]string{"event_type": "page_view", "url": "https://example.org"}},
+			{RowKey: "contact-2", Date: date, Cells: map[string]string{"event_type": "add_to_cart"}},
+		},
+	}}
+	result, err := repo.Write(ctx, eventSet)
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	read, err := repo.Read(ctx, "contact-1")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(read.Events["front"]) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(read.Events["front"]))
+	}
+
+	found, err := repo.Search(ctx, bigtable.PrefixRange("contact-"), bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13")))
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(found.Events["front"]) != 1 || found.Events["front"][0].Cells["device_type"] != "Computer" {
+		t.Fatalf("expected the purchase with all its cells, got %v", found.Events["front"])
+	}
+
+	count, err := repo.Increment(ctx, "contact-2", "front", "views", 2)
+	if err != nil || count != 2 {
+		t.Fatalf("expected a counter of 2, got %d %v", count, err)
+	}
+
+	if err = repo.DeleteRow(ctx, "contact-1"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err = repo.Read(ctx, "contact-1"); err != repository.ErrRowNotFound {
+		t.Fatalf("expected the row to be deleted, got %v", err)
+	}
+}
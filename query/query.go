@@ -0,0 +1,240 @@
+/*
+Package query builds Big Table filters from predicates written with the human-readable names of the mapping.
+
+	q := query.Where("event_type").In("purchase", "add_to_cart").And("device_type").Eq("Computer")
+	filter, err := q.Filter(mapper)
+	if err != nil {
+		return err
+	}
+	eventSet, err := repo.Search(ctx, bigtable.PrefixRange("contact-"), filter)
+	if err != nil {
+		return err
+	}
+	eventSet = q.Apply(eventSet)
+
+Each predicate is resolved through the mapping:
+  - a column from the "raws" section matches its short column and the given values as they are,
+  - a column from the "mapped" section matches its short column and the short values of the given values,
+  - a column from the "reversed" section matches the columns named after the short values of the given values.
+
+Big Table filters apply to cells, whereas the predicates of a query apply to the columns of an event, which are
+stored in distinct cells. So the filter of a query only keeps the rows having cells that satisfy each of its
+predicates, so that the other rows are neither returned nor counted by the row limits, and matches the cells of these
+rows satisfying at least one of the predicates. Apply keeps the events satisfying all of them once they are read.
+*/
+package query
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"github.com/sendinblue/bigtable-access-layer/mapping"
+)
+
+// Query is a conjunction of predicates on the columns of the events.
+type Query struct {
+	family     string
+	predicates []*Predicate
+}
+
+// Predicate is a condition on the value of a column, completed by one of its methods.
+type Predicate struct {
+	query  *Query
+	column string
+	values []string
+	exists bool
+}
+
+// Where starts a query with a predicate on the given column.
+func Where(column string) *Predicate {
+	return (&Query{}).And(column)
+}
+
+// And adds a predicate on the given column to the query.
+func (q *Query) And(column string) *Predicate {
+	p := &Predicate{query: q, column: column}
+	q.predicates = append(q.predicates, p)
+	return p
+}
+
+// InFamily restricts the query to the events of a single column family.
+func (q *Query) InFamily(family string) *Query {
+	q.family = family
+	return q
+}
+
+// Eq requires the column to have the given value.
+func (p *Predicate) Eq(value string) *Query {
+	return p.In(value)
+}
+
+// In requires the column to have one of the given values.
+func (p *Predicate) In(values ...string) *Query {
+	p.values = values
+	return p.query
+}
+
+// Exists requires the event to have the column, whatever its value.
+func (p *Predicate) Exists() *Query {
+	p.exists = true
+	return p.query
+}
+
+// Filter translates the query into a bigtable.Filter matching the cells that satisfy at least one of its predicates,
+// in the rows satisfying all of them (see the package documentation). It returns an error if a column or a value of a predicate can't be resolved through the mapping.
+func (q *Query) Filter(mapper *mapping.Mapper) (bigtable.Filter, error) {
+	if len(q.predicates) == 0 {
+		return nil, errors.New("the query has no predicate")
+	}
+	filters := make([]bigtable.Filter, 0, len(q.predicates))
+	for _, p := range q.predicates {
+		f, err := p.filter(mapper.Mapping)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	if len(filters) == 1 {
+		return q.inFamily(filters[0]), nil
+	}
+	// each predicate gates the row before the cells matching any of them are kept
+	chain := make([]bigtable.Filter, 0, len(filters)+1)
+	for _, f := range filters {
+		chain = append(chain, bigtable.ConditionFilter(f, bigtable.PassAllFilter(), nil))
+	}
+	chain = append(chain, bigtable.InterleaveFilters(filters...))
+	return q.inFamily(bigtable.ChainFilters(chain...)), nil
+}
+
+// inFamily restricts the filter to the column family of the query, if any.
+func (q *Query) inFamily(filter bigtable.Filter) bigtable.Filter {
+	if q.family == "" {
+		return filter
+	}
+	return bigtable.ChainFilters(bigtable.FamilyFilter(exactMatch(q.family)), filter)
+}
+
+// Match reports whether the event satisfies all the predicates of the query.
+func (q *Query) Match(event *data.Event) bool {
+	for _, p := range q.predicates {
+		value, ok := event.Cells[p.column]
+		if !ok {
+			return false
+		}
+		if p.exists {
+			continue
+		}
+		matched := false
+		for _, v := range p.values {
+			if v == value {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns a data.Set holding the events of the given one that satisfy all the predicates of the query.
+func (q *Query) Apply(eventSet *data.Set) *data.Set {
+	result := &data.Set{Events: make(map[string][]*data.Event), Columns: eventSet.Columns}
+	for family, events := range eventSet.Events {
+		if q.family != "" && family != q.family {
+			continue
+		}
+		for _, event := range events {
+			if q.Match(event) {
+				result.Events[family] = append(result.Events[family], event)
+			}
+		}
+	}
+	return result
+}
+
+// filter translates the predicate into a bigtable.Filter matching the cells that satisfy it.
+func (p *Predicate) filter(m *mapping.Mapping) (bigtable.Filter, error) {
+	if !p.exists && len(p.values) == 0 {
+		return nil, errors.Errorf("the predicate on column %q has no value", p.column)
+	}
+	for short, name := range m.Raws {
+		if name != p.column {
+			continue
+		}
+		if p.exists {
+			return bigtable.ColumnFilter(exactMatch(short)), nil
+		}
+		return bigtable.ChainFilters(bigtable.ColumnFilter(exactMatch(short)), bigtable.ValueFilter(anyOf(p.values))), nil
+	}
+	for short, rule := range m.Mapped {
+		if rule.Name != p.column {
+			continue
+		}
+		if p.exists {
+			return bigtable.ColumnFilter(exactMatch(short)), nil
+		}
+		values, err := shortValues(rule, p.values)
+		if err != nil {
+			return nil, err
+		}
+		return bigtable.ChainFilters(bigtable.ColumnFilter(exactMatch(short)), bigtable.ValueFilter(anyOf(values))), nil
+	}
+	for _, rule := range m.Reversed {
+		if rule.Name != p.column {
+			continue
+		}
+		if p.exists {
+			columns := make([]string, 0, len(rule.Values))
+			for short := range rule.Values {
+				columns = append(columns, short)
+			}
+			return bigtable.ColumnFilter(anyOf(columns)), nil
+		}
+		columns, err := shortValues(rule, p.values)
+		if err != nil {
+			return nil, err
+		}
+		return bigtable.ColumnFilter(anyOf(columns)), nil
+	}
+	return nil, errors.Errorf("column %q is not part of the mapping", p.column)
+}
+
+// shortValues translates the values of a mapped or reversed column into their short version.
+func shortValues(rule mapping.Map, values []string) ([]string, error) {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		found := false
+		for short, full := range rule.Values {
+			if full == value {
+				result = append(result, short)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("value %q is not a value of column %q in the mapping", value, rule.Name)
+		}
+	}
+	return result, nil
+}
+
+// exactMatch returns a regular expression matching exactly the given string.
+func exactMatch(s string) string {
+	return "^" + regexp.QuoteMeta(s) + "$"
+}
+
+// anyOf returns a regular expression matching exactly one of the given strings.
+func anyOf(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = regexp.QuoteMeta(v)
+	}
+	sort.Strings(quoted)
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
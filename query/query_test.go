@@ -0,0 +1,180 @@
+package query
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"github.com/sendinblue/bigtable-access-layer/internal/inspect"
+	"github.com/sendinblue/bigtable-access-layer/mapping"
+	"github.com/sendinblue/bigtable-access-layer/memory"
+	"github.com/sendinblue/bigtable-access-layer/repository"
+)
+
+const testMapping = `{
+  "raws": {"u": "url"},
+  "mapped": {
+    "d": {"name": "device_type", "values": {"1": "Smartphone", "2": "Computer"}},
+    "e": {"name": "event_type", "values": {"11": "page_view", "12": "add_to_cart", "13": "purchase"}}
+  },
+  "reversed": [
+    {"name": "order_status", "values": {"1": "pending_payment", "3": "processing", "4": "completed"}}
+  ]
+}`
+
+func getMapper(t *testing.T) *mapping.Mapper {
+	jsonMapping, err := mapping.LoadMapping([]byte(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mapping.NewMapper(jsonMapping)
+}
+
+func TestQuery_Filter(t *testing.T) {
+	mapper := getMapper(t)
+	tests := []struct {
+		query    *Query
+		expected bigtable.Filter
+	}{
+		{
+			query:    Where("event_type").Eq("purchase"),
+			expected: bigtable.ChainFilters(bigtable.ColumnFilter("^e$"), bigtable.ValueFilter("^(13)$")),
+		},
+		{
+			query:    Where("url").In("https://example.org/a.b"),
+			expected: bigtable.ChainFilters(bigtable.ColumnFilter("^u$"), bigtable.ValueFilter(`^(https://example\.org/a\.b)$`)),
+		},
+		{
+			query:    Where("order_status").In("processing", "completed"),
+			expected: bigtable.ColumnFilter("^(3|4)$"),
+		},
+		{
+			query: Where("event_type").In("purchase", "add_to_cart").And("device_type").Eq("Computer").InFamily("front"),
+			expected: bigtable.ChainFilters(
+				bigtable.FamilyFilter("^front$"),
+				bigtable.ChainFilters(
+					bigtable.ConditionFilter(
+						bigtable.ChainFilters(bigtable.ColumnFilter("^e$"), bigtable.ValueFilter("^(12|13)$")),
+						bigtable.PassAllFilter(), nil,
+					),
+					bigtable.ConditionFilter(
+						bigtable.ChainFilters(bigtable.ColumnFilter("^d$"), bigtable.ValueFilter("^(2)$")),
+						bigtable.PassAllFilter(), nil,
+					),
+					bigtable.InterleaveFilters(
+						bigtable.ChainFilters(bigtable.ColumnFilter("^e$"), bigtable.ValueFilter("^(12|13)$")),
+						bigtable.ChainFilters(bigtable.ColumnFilter("^d$"), bigtable.ValueFilter("^(2)$")),
+					),
+				),
+			),
+		},
+		{
+			query:    Where("device_type").Exists(),
+			expected: bigtable.ColumnFilter("^d$"),
+		},
+	}
+	for _, test := range tests {
+		filter, err := test.query.Filter(mapper)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if inspect.Describe(filter) != inspect.Describe(test.expected) {
+			t.Errorf("expected %s, got %s", test.expected, filter)
+		}
+	}
+}
+
+func TestQuery_FilterErrors(t *testing.T) {
+	mapper := getMapper(t)
+	tests := map[string]*Query{
+		`column "browser" is not part of the mapping`:                         Where("browser").Eq("firefox"),
+		`value "refund" is not a value of column "event_type" in the mapping`: Where("event_type").In("purchase", "refund"),
+		`value "lost" is not a value of column "order_status" in the mapping`: Where("order_status").Eq("lost"),
+		`the predicate on column "device_type" has no value`:                  Where("device_type").In(),
+		"the query has no predicate":                                          {},
+	}
+	for expected, q := range tests {
+		_, err := q.Filter(mapper)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestQuery_Search(t *testing.T) {
+	ctx := context.Background()
+	mapper := getMapper(t)
+	repo := repository.NewRepositoryWithAdapter(memory.NewAdapter(), mapper)
+	date := time.Unix(1000, 0)
+	event := func(key string, seconds int, eventType string, device string) *data.Event {
+		return &data.Event{
+			RowKey: key,
+			Date:   date.Add(time.Duration(seconds) * time.Second),
+			Cells:  map[string]string{"event_type": eventType, "device_type": device},
+		}
+	}
+	result, err := repo.Write(ctx, &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			event("contact-1", 0, "purchase", "Computer"),
+			event("contact-1", 1, "purchase", "Smartphone"),
+			event("contact-2", 0, "page_view", "Computer"),
+			event("contact-3", 0, "add_to_cart", "Computer"),
+		},
+	}})
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	q := Where("event_type").In("purchase", "add_to_cart").And("device_type").Eq("Computer")
+	filter, err := q.Filter(mapper)
+	if err != nil {
+		t.Fatalf("failed to build the filter: %v", err)
+	}
+	eventSet, err := repo.Search(ctx, bigtable.PrefixRange("contact-"), filter)
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	eventSet = q.Apply(eventSet)
+	if len(eventSet.Events["front"]) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(eventSet.Events["front"]))
+	}
+	for _, e := range eventSet.Events["front"] {
+		if e.Cells["device_type"] != "Computer" || e.Cells["event_type"] == "page_view" {
+			t.Fatalf("unexpected event %v", e.Cells)
+		}
+	}
+}
+
+func TestQuery_SearchMaxRows(t *testing.T) {
+	ctx := context.Background()
+	mapper := getMapper(t)
+	repo := repository.NewRepositoryWithAdapter(memory.NewAdapter(), mapper, repository.NewMaxRowsOption(1))
+	date := time.Unix(1000, 0)
+	result, err := repo.Write(ctx, &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "a", Date: date, Cells: map[string]string{"event_type": "purchase", "device_type": "Smartphone"}},
+			{RowKey: "b", Date: date, Cells: map[string]string{"event_type": "purchase", "device_type": "Computer"}},
+		},
+	}})
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	// the row satisfying only one of the predicates doesn't take the single slot
+	q := Where("event_type").Eq("purchase").And("device_type").Eq("Computer")
+	filter, err := q.Filter(mapper)
+	if err != nil {
+		t.Fatalf("failed to build the filter: %v", err)
+	}
+	eventSet, err := repo.Search(ctx, bigtable.RowRange{}, filter)
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	eventSet = q.Apply(eventSet)
+	if len(eventSet.Events["front"]) != 1 || eventSet.Events["front"][0].RowKey != "b" {
+		t.Fatalf("expected the event of row b, got %v", eventSet.Events["front"])
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// Snapshot is the state of a row at a given instant, as returned by ReadAsOf.
+type Snapshot struct {
+	// Events holds, for each column family, a single event gathering the latest value of each column at the instant.
+	// Its date is the one of the latest event taken into account.
+	Events map[string]*data.Event
+	// History holds all the events that happened up to the instant, sorted by date for each column family.
+	History *data.Set
+}
+
+/*
+ReadAsOf reads a row from the repository as it was at the given instant.
+
+Only the cells written up to t (inclusive) are read. For each column family, the events are then folded in time order
+into a single snapshot event holding the latest value of each column, so that a column missing from the latest events
+keeps the value it had before. The events used to build the snapshot are also returned as the history of the row.
+The options allow to further restrict the read, for instance to a single column family or to some columns only.
+*/
+func (r *Repository) ReadAsOf(ctx context.Context, key string, t time.Time, opts ...CallOption) (*Snapshot, error) {
+	until := bigtable.TimestampRangeFilterMicros(0, bigtable.Time(t).TruncateToMilliseconds()+1000)
+	o := newCallOptions(opts)
+	history, err := r.read(ctx, "ReadAsOf", key, o, o.filter(r.mapper, until))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Events: make(map[string]*data.Event, len(history.Events)), History: history}
+	for family, events := range history.Events {
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].Date.Before(events[j].Date)
+		})
+		snapshot.Events[family] = fold(key, events)
+	}
+	return snapshot, nil
+}
+
+// fold merges the given events, sorted by date, into a single event holding the latest value of each column.
+func fold(key string, events []*data.Event) *data.Event {
+	result := &data.Event{RowKey: key, Cells: make(map[string]string)}
+	for _, event := range events {
+		for column, value := range event.Cells {
+			result.Cells[column] = value
+		}
+		result.Date = event.Date
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+func TestRepository_ReadAsOf(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t))
+	day := func(d int) time.Time {
+		return time.Date(2021, time.March, d, 0, 0, 0, 0, time.UTC)
+	}
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "contacta-1", Date: day(1), Cells: map[string]string{"event_type": "page_view", "device_type": "Smartphone", "url": "https://example.org/a"}},
+			{RowKey: "contacta-1", Date: day(2), Cells: map[string]string{"event_type": "add_to_cart", "device_type": "Computer"}},
+			{RowKey: "contacta-1", Date: day(3), Cells: map[string]string{"event_type": "purchase"}},
+		},
+		"blog": {
+			{RowKey: "contacta-1", Date: day(3), Cells: map[string]string{"event_type": "page_view"}},
+		},
+	}}
+	result, err := repo.Write(ctx, eventSet)
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	snapshot, err := repo.ReadAsOf(ctx, "contacta-1", day(2))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, ok := snapshot.Events["blog"]; ok {
+		t.Fatalf("unexpected snapshot of the blog family")
+	}
+	front := snapshot.Events["front"]
+	if front == nil {
+		t.Fatalf("missing snapshot of the front family")
+	}
+	expected := map[string]string{"event_type": "add_to_cart", "device_type": "Computer", "url": "https://example.org/a"}
+	if len(front.Cells) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, front.Cells)
+	}
+	for column, value := range expected {
+		if front.Cells[column] != value {
+			t.Fatalf("expected %v, got %v", expected, front.Cells)
+		}
+	}
+	if !front.Date.Equal(day(2)) || front.RowKey != "contacta-1" {
+		t.Fatalf("unexpected snapshot event %s at %s", front.RowKey, front.Date)
+	}
+	history := snapshot.History.Events["front"]
+	if len(history) != 2 || !history[0].Date.Equal(day(1)) || !history[1].Date.Equal(day(2)) {
+		t.Fatalf("expected the 2 first events in time order, got %d events", len(history))
+	}
+
+	snapshot, err = repo.ReadAsOf(ctx, "contacta-1", day(4), NewColumnsOption("event_type"))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if cells := snapshot.Events["front"].Cells; len(cells) != 1 || cells["event_type"] != "purchase" {
+		t.Fatalf("expected the latest event type only, got %v", cells)
+	}
+	if cells := snapshot.Events["blog"].Cells; len(cells) != 1 || cells["event_type"] != "page_view" {
+		t.Fatalf("expected the blog page view, got %v", cells)
+	}
+
+	snapshot, err = repo.ReadAsOf(ctx, "contacta-1", day(1).Add(-time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(snapshot.Events) != 0 {
+		t.Fatalf("expected no snapshot before the first event, got %d", len(snapshot.Events))
+	}
+}
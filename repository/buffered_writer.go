@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// ErrWriterClosed is returned by the BufferedWriter once it has been closed.
+var ErrWriterClosed = errors.New("buffered writer closed")
+
+// BufferedWriterConfig describes when the BufferedWriter flushes its buffer.
+type BufferedWriterConfig struct {
+	// MaxEvents is the number of buffered events triggering a flush.
+	MaxEvents int
+	// MaxBytes is the estimated size in bytes of the buffered events triggering a flush.
+	MaxBytes int
+	// FlushInterval is the maximum time an event stays in the buffer. Zero disables the periodic flush.
+	FlushInterval time.Duration
+	// MaxPendingEvents is the maximum number of events either buffered or being flushed. Add blocks when it is reached.
+	MaxPendingEvents int
+	// OnFailure, if set, is called after each flush that could not write some of the rows.
+	// The events of these rows are dropped without any report when it is nil.
+	OnFailure func(result *WriteResult)
+	// OnError, if set, is called with the flushed events after each flush for which Repository.Write returned an
+	// error, such as a request failing as a whole or a rejection by a Hook. The events are dropped without any report
+	// when it is nil, unless the flush was requested by Flush or Close which return the error.
+	OnError func(eventSet *data.Set, err error)
+}
+
+// DefaultBufferedWriterConfig returns a BufferedWriterConfig flushing every 500 events, 4MB or second, and holding
+// up to 10,000 pending events.
+func DefaultBufferedWriterConfig() BufferedWriterConfig {
+	return BufferedWriterConfig{
+		MaxEvents:        500,
+		MaxBytes:         4 << 20,
+		FlushInterval:    time.Second,
+		MaxPendingEvents: 10000,
+	}
+}
+
+/*
+BufferedWriter gathers the events added by many goroutines and writes them to the repository in batches, instead of
+sending one request per event.
+
+The buffer is flushed by a background goroutine as soon as it holds MaxEvents events or MaxBytes bytes, every
+FlushInterval, and when Flush or Close are called. The events are written with Repository.Write, so the events of a
+same row are grouped into a single mutation. Add blocks while MaxPendingEvents events are waiting to be written,
+which slows the producers down to the pace of Big Table.
+
+The rows that could not be written are reported to the OnFailure callback of the configuration, and the flushes that
+failed as a whole to the OnError callback.
+*/
+type BufferedWriter struct {
+	repo   *Repository
+	config BufferedWriterConfig
+
+	mu     sync.Mutex
+	buffer *data.Set
+	events int
+	bytes  int
+	closed bool
+
+	pending  chan struct{}
+	full     chan struct{}
+	requests chan flushRequest
+	stop     chan struct{}
+	stopped  chan struct{}
+	// lastErr is the error of the last flush, made by the background goroutine when it stops, read once it is stopped.
+	lastErr error
+}
+
+type flushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+// NewBufferedWriter creates a BufferedWriter writing to the given repository and starts its background goroutine,
+// which runs until Close is called.
+func NewBufferedWriter(repo *Repository, config BufferedWriterConfig) *BufferedWriter {
+	defaults := DefaultBufferedWriterConfig()
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = defaults.MaxEvents
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaults.MaxBytes
+	}
+	if config.MaxPendingEvents <= 0 {
+		config.MaxPendingEvents = defaults.MaxPendingEvents
+	}
+	w := &BufferedWriter{
+		repo:     repo,
+		config:   config,
+		buffer:   newBufferSet(),
+		pending:  make(chan struct{}, config.MaxPendingEvents),
+		full:     make(chan struct{}, 1),
+		requests: make(chan flushRequest),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Add adds an event of the given column family to the buffer. It blocks while the writer holds MaxPendingEvents
+// events and returns the context's error if the context is done before the event can be buffered.
+func (w *BufferedWriter) Add(ctx context.Context, family string, event *data.Event) error {
+	if w.isClosed() {
+		return ErrWriterClosed
+	}
+	select {
+	case w.pending <- struct{}{}:
+	default:
+		// the writer is full: make sure a flush is on its way before waiting for it
+		w.signalFull()
+		select {
+		case w.pending <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.stopped:
+			return ErrWriterClosed
+		}
+	}
+	_, size := w.repo.eventSize(family, event)
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		<-w.pending
+		return ErrWriterClosed
+	}
+	w.buffer.Events[family] = append(w.buffer.Events[family], event)
+	w.events++
+	w.bytes += size + len(event.RowKey)
+	full := w.events >= w.config.MaxEvents || w.bytes >= w.config.MaxBytes
+	w.mu.Unlock()
+	if full {
+		w.signalFull()
+	}
+	return nil
+}
+
+// Flush writes the buffered events and waits for them to be written. It returns the error returned by
+// Repository.Write, which is reported to the OnError callback as well, the rows that could not be written are
+// reported to the OnFailure callback.
+func (w *BufferedWriter) Flush(ctx context.Context) error {
+	req := flushRequest{ctx: ctx, done: make(chan error, 1)}
+	select {
+	case w.requests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.stopped:
+		return ErrWriterClosed
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting new events, writes the buffered ones and stops the background goroutine.
+// It returns the error of the last flush, which is reported to the OnError callback as well. When the context is done
+// before the buffered events are written, Close returns the context's error but the background goroutine still writes
+// them before it stops, so they are never lost.
+func (w *BufferedWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.stop)
+	select {
+	case <-w.stopped:
+		return w.lastErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *BufferedWriter) run() {
+	defer close(w.stopped)
+	var tick <-chan time.Time
+	if w.config.FlushInterval > 0 {
+		ticker := time.NewTicker(w.config.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			_ = w.flush(context.Background())
+		case <-w.full:
+			_ = w.flush(context.Background())
+		case req := <-w.requests:
+			req.done <- w.flush(req.ctx)
+		case <-w.stop:
+			// the last flush doesn't depend on the context of Close, so the buffered events are written anyway
+			w.lastErr = w.flush(context.Background())
+			return
+		}
+	}
+}
+
+// flush writes the buffered events, releasing their room in the writer once they are written.
+func (w *BufferedWriter) flush(ctx context.Context) error {
+	w.mu.Lock()
+	eventSet, events := w.buffer, w.events
+	w.buffer, w.events, w.bytes = newBufferSet(), 0, 0
+	w.mu.Unlock()
+	if events == 0 {
+		return nil
+	}
+	defer func() {
+		for i := 0; i < events; i++ {
+			<-w.pending
+		}
+	}()
+	result, err := w.repo.Write(ctx, eventSet)
+	if result.HasFailures() && w.config.OnFailure != nil {
+		w.config.OnFailure(result)
+	}
+	if err != nil && w.config.OnError != nil {
+		w.config.OnError(eventSet, err)
+	}
+	return err
+}
+
+func (w *BufferedWriter) signalFull() {
+	select {
+	case w.full <- struct{}{}:
+	default:
+	}
+}
+
+func (w *BufferedWriter) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+func newBufferSet() *data.Set {
+	return &data.Set{Events: make(map[string][]*data.Event)}
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// blockingBulkAdapter sends the row keys of each ApplyBulk to calls, blocking until the test receives them.
+type blockingBulkAdapter struct {
+	mockAdapter
+	calls chan []string
+}
+
+func (a *blockingBulkAdapter) ApplyBulk(_ context.Context, rowKeys []string, _ []*bigtable.Mutation, _ ...bigtable.ApplyOption) (errs []error, err error) {
+	a.calls <- rowKeys
+	return nil, nil
+}
+
+func bufferedEvent(key string, i int) *data.Event {
+	return &data.Event{
+		RowKey: key,
+		Date:   time.Date(2021, time.May, 1, 0, 0, i, 0, time.UTC),
+		Cells:  map[string]string{"event_type": "page_view", "device_type": "Computer"},
+	}
+}
+
+func TestBufferedWriter(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t))
+	config := DefaultBufferedWriterConfig()
+	config.MaxEvents = 5
+	config.OnFailure = func(result *WriteResult) {
+		t.Errorf("unexpected failures: %v", result.Errors())
+	}
+	writer := NewBufferedWriter(repo, config)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				if err := writer.Add(ctx, "front", bufferedEvent(fmt.Sprintf("contactb-%d", g), i)); err != nil {
+					t.Errorf("failed to add: %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := writer.Close(ctx); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if err := writer.Add(ctx, "front", bufferedEvent("contactb-0", 9)); err != ErrWriterClosed {
+		t.Fatalf("expected ErrWriterClosed, got %v", err)
+	}
+
+	for g := 0; g < 4; g++ {
+		eventSet, err := repo.Read(ctx, fmt.Sprintf("contactb-%d", g))
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if len(eventSet.Events["front"]) != 5 {
+			t.Fatalf("expected 5 events, got %d", len(eventSet.Events["front"]))
+		}
+	}
+}
+
+func TestBufferedWriter_Backpressure(t *testing.T) {
+	ctx := context.Background()
+	adapter := &blockingBulkAdapter{calls: make(chan []string)}
+	repo := &Repository{adapter: adapter, mapper: getMockMapper(t)}
+	writer := NewBufferedWriter(repo, BufferedWriterConfig{MaxEvents: 1, MaxPendingEvents: 2})
+
+	if err := writer.Add(ctx, "front", bufferedEvent("contact-1", 0)); err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+	if err := writer.Add(ctx, "front", bufferedEvent("contact-2", 0)); err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+	// the first flush is blocked in ApplyBulk, the writer is full
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := writer.Add(timeoutCtx, "front", bufferedEvent("contact-3", 0)); err != context.DeadlineExceeded {
+		t.Fatalf("expected the add to time out, got %v", err)
+	}
+
+	added := make(chan error)
+	go func() {
+		added <- writer.Add(ctx, "front", bufferedEvent("contact-3", 0))
+	}()
+	written := make(map[string]bool)
+	for len(written) < 2 {
+		for _, key := range <-adapter.calls {
+			written[key] = true
+		}
+	}
+	if !written["contact-1"] || !written["contact-2"] {
+		t.Fatalf("expected contact-1 and contact-2 to be written first, got %v", written)
+	}
+	if err := <-added; err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+
+	closed := make(chan error)
+	go func() {
+		closed <- writer.Close(ctx)
+	}()
+	for !written["contact-3"] {
+		for _, key := range <-adapter.calls {
+			written[key] = true
+		}
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
+
+func TestBufferedWriter_Interval(t *testing.T) {
+	ctx := context.Background()
+	adapter := &blockingBulkAdapter{calls: make(chan []string)}
+	repo := &Repository{adapter: adapter, mapper: getMockMapper(t)}
+	writer := NewBufferedWriter(repo, BufferedWriterConfig{FlushInterval: 10 * time.Millisecond})
+	defer writer.Close(ctx)
+
+	if err := writer.Add(ctx, "front", bufferedEvent("contact-1", 0)); err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+	select {
+	case keys := <-adapter.calls:
+		if len(keys) != 1 || keys[0] != "contact-1" {
+			t.Fatalf("expected contact-1 to be written, got %v", keys)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the buffer was not flushed after the interval")
+	}
+}
+
+func TestBufferedWriter_Failures(t *testing.T) {
+	ctx := context.Background()
+	repo := &Repository{adapter: &countingBulkAdapter{failingCalls: map[int]bool{1: true}}, mapper: getMockMapper(t)}
+	var failures *WriteResult
+	writer := NewBufferedWriter(repo, BufferedWriterConfig{OnFailure: func(result *WriteResult) {
+		failures = result
+	}})
+
+	for _, key := range []string{"contact-1", "contact-2", "contact-1"} {
+		if err := writer.Add(ctx, "front", bufferedEvent(key, len(key))); err != nil {
+			t.Fatalf("failed to add: %v", err)
+		}
+	}
+	if err := writer.Flush(ctx); err != errBulk {
+		t.Fatalf("expected the bulk error, got %v", err)
+	}
+	if len(failures.Failures) != 2 {
+		t.Fatalf("expected 2 failed rows, got %d", len(failures.Failures))
+	}
+	if n := len(failures.FailedSet().Events["front"]); n != 3 {
+		t.Fatalf("expected 3 failed events, got %d", n)
+	}
+	if err := writer.Close(ctx); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
+
+func TestBufferedWriter_Errors(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepositoryWithAdapter(mockAdapter{}, getMockMapper(t), NewHookOption(stampHook{device: "Computer"}))
+	errs := make(chan error, 1)
+	writer := NewBufferedWriter(repo, BufferedWriterConfig{MaxEvents: 1, OnError: func(eventSet *data.Set, err error) {
+		if len(eventSet.Events["front"]) != 1 {
+			t.Errorf("expected the rejected event, got %v", eventSet.Events)
+		}
+		errs <- err
+	}})
+
+	event := &data.Event{RowKey: "contact-1", Date: time.Now(), Cells: map[string]string{"url": "https://example.org"}}
+	if err := writer.Add(ctx, "front", event); err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil || err.Error() != "missing event type" {
+			t.Fatalf("expected the error of the hook, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the error of the background flush was not reported")
+	}
+	if err := writer.Close(ctx); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+}
+
+func TestBufferedWriter_CloseCanceled(t *testing.T) {
+	ctx := context.Background()
+	adapter := &countingBulkAdapter{}
+	repo := &Repository{adapter: adapter, mapper: getMockMapper(t)}
+	writer := NewBufferedWriter(repo, BufferedWriterConfig{})
+	for i := 0; i < 3; i++ {
+		if err := writer.Add(ctx, "front", bufferedEvent("contact-1", i)); err != nil {
+			t.Fatalf("failed to add: %v", err)
+		}
+	}
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := writer.Close(canceledCtx); err != nil && err != context.Canceled {
+		t.Fatalf("unexpected error %v", err)
+	}
+	<-writer.stopped
+	if len(adapter.calls) != 1 || len(writer.pending) != 0 {
+		t.Fatalf("expected the buffered events to be written, got %d calls and %d pending events", len(adapter.calls), len(writer.pending))
+	}
+}
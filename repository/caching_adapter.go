@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/internal/inspect"
+)
+
+// cacheItemOverhead is the estimated size of a cell in the cache besides its column and value.
+const cacheItemOverhead = 32
+
+// CacheStats are the counters of a CachingAdapter.
+type CacheStats struct {
+	// Hits is the number of ReadRow served from the cache.
+	Hits uint64
+	// Misses is the number of ReadRow that weren't served from the cache, including the ones that waited for a
+	// concurrent identical read.
+	Misses uint64
+	// Evictions is the number of entries removed from the cache to make room for new ones.
+	Evictions uint64
+}
+
+/*
+CachingAdapter is an Adapter that caches the rows returned by ReadRow, by row key and read options.
+
+  - The cache is bounded by the estimated size of the rows it holds, the least recently used rows being evicted first.
+  - A row expires once its TTL is elapsed, a TTL of zero or less meaning the rows never expire.
+  - Concurrent reads of the same row with the same options result in a single call to the wrapped adapter. When the
+    context of the caller making the call is done, the other callers make the call again instead of failing.
+  - The rows written through ApplyBulk, CheckAndMutate or ApplyReadModifyWrite are removed from the cache. The writes
+    that don't go through this adapter are only visible once the cached rows expire.
+
+The cached rows are shared between the callers and must not be modified.
+ReadRows is not cached.
+*/
+type CachingAdapter struct {
+	adapter  Adapter
+	maxBytes int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu         sync.Mutex
+	lru        *list.List
+	entries    map[string]*list.Element
+	rows       map[string]map[string]bool
+	inflight   map[string]*cacheCall
+	size       int
+	generation uint64
+
+	hits, misses, evictions uint64
+}
+
+type cacheEntry struct {
+	key     string
+	row     string
+	value   bigtable.Row
+	size    int
+	expires time.Time
+}
+
+// cacheCall is a ReadRow in progress, shared by the concurrent callers asking for the same entry.
+type cacheCall struct {
+	done  chan struct{}
+	value bigtable.Row
+	err   error
+	// canceled reports that the read failed because the context of the caller making it was done.
+	canceled bool
+}
+
+func NewCachingAdapter(adapter Adapter, maxBytes int, ttl time.Duration) *CachingAdapter {
+	return &CachingAdapter{
+		adapter:  adapter,
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		rows:     make(map[string]map[string]bool),
+		inflight: make(map[string]*cacheCall),
+	}
+}
+
+type CachingAdapterOption struct {
+	maxBytes int
+	ttl      time.Duration
+}
+
+// NewCachingAdapterOption caches up to maxBytes of rows read by the repository for the given TTL.
+func NewCachingAdapterOption(maxBytes int, ttl time.Duration) *CachingAdapterOption {
+	return &CachingAdapterOption{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+	}
+}
+
+func (opt *CachingAdapterOption) apply(repo *Repository) {
+	repo.adapter = NewCachingAdapter(repo.adapter, opt.maxBytes, opt.ttl)
+}
+
+// Stats returns the counters of the cache.
+func (a *CachingAdapter) Stats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&a.hits),
+		Misses:    atomic.LoadUint64(&a.misses),
+		Evictions: atomic.LoadUint64(&a.evictions),
+	}
+}
+
+func (a *CachingAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	key := cacheKey(row, opts)
+	a.mu.Lock()
+	if value, ok := a.get(key); ok {
+		a.mu.Unlock()
+		atomic.AddUint64(&a.hits, 1)
+		return value, nil
+	}
+	atomic.AddUint64(&a.misses, 1)
+	for {
+		call, ok := a.inflight[key]
+		if !ok {
+			break
+		}
+		a.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// the cancellation of the caller that made the read doesn't concern the other ones, which read again
+		if !call.canceled || ctx.Err() != nil {
+			return call.value, call.err
+		}
+		a.mu.Lock()
+		if value, ok := a.get(key); ok {
+			a.mu.Unlock()
+			return value, nil
+		}
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	a.inflight[key] = call
+	generation := a.generation
+	a.mu.Unlock()
+
+	call.value, call.err = a.adapter.ReadRow(ctx, row, opts...)
+	call.canceled = call.err != nil && ctx.Err() != nil
+
+	a.mu.Lock()
+	if a.inflight[key] == call {
+		delete(a.inflight, key)
+	}
+	// a row written during the read may have been read before the write, so it isn't cached
+	if call.err == nil && generation == a.generation {
+		a.set(key, row, call.value)
+	}
+	a.mu.Unlock()
+	close(call.done)
+	return call.value, call.err
+}
+
+func (a *CachingAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	return a.adapter.ReadRows(ctx, arg, f, opts...)
+}
+
+func (a *CachingAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) (errs []error, err error) {
+	defer a.invalidate(rowKeys...)
+	return a.adapter.ApplyBulk(ctx, rowKeys, muts, opts...)
+}
+
+func (a *CachingAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	defer a.invalidate(row)
+	return a.adapter.CheckAndMutate(ctx, row, cond, mtrue, mfalse)
+}
+
+func (a *CachingAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	defer a.invalidate(row)
+	return a.adapter.ApplyReadModifyWrite(ctx, row, m)
+}
+
+// get returns the entry if it is cached and not expired. It must be called with the lock held.
+func (a *CachingAdapter) get(key string) (bigtable.Row, bool) {
+	element, ok := a.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if a.ttl > 0 && !a.now().Before(entry.expires) {
+		a.remove(element)
+		return nil, false
+	}
+	a.lru.MoveToFront(element)
+	return entry.value, true
+}
+
+// set caches the entry and evicts the least recently used ones to keep the cache within its size.
+// It must be called with the lock held.
+func (a *CachingAdapter) set(key string, row string, value bigtable.Row) {
+	size := rowSize(key, value)
+	if size > a.maxBytes {
+		return
+	}
+	if element, ok := a.entries[key]; ok {
+		a.remove(element)
+	}
+	for a.size+size > a.maxBytes {
+		a.remove(a.lru.Back())
+		atomic.AddUint64(&a.evictions, 1)
+	}
+	entry := &cacheEntry{key: key, row: row, value: value, size: size, expires: a.now().Add(a.ttl)}
+	a.entries[key] = a.lru.PushFront(entry)
+	if a.rows[row] == nil {
+		a.rows[row] = make(map[string]bool)
+	}
+	a.rows[row][key] = true
+	a.size += size
+}
+
+// remove removes an entry from the cache. It must be called with the lock held.
+func (a *CachingAdapter) remove(element *list.Element) {
+	entry := a.lru.Remove(element).(*cacheEntry)
+	delete(a.entries, entry.key)
+	delete(a.rows[entry.row], entry.key)
+	if len(a.rows[entry.row]) == 0 {
+		delete(a.rows, entry.row)
+	}
+	a.size -= entry.size
+}
+
+// invalidate removes all the entries of the given rows and prevents the reads in progress from being cached.
+func (a *CachingAdapter) invalidate(rows ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.generation++
+	for _, row := range rows {
+		for key := range a.rows[row] {
+			a.remove(a.entries[key])
+		}
+		for key := range a.inflight {
+			if strings.HasPrefix(key, row+"\x00") {
+				delete(a.inflight, key)
+			}
+		}
+	}
+}
+
+// cacheKey builds the key of a ReadRow from the row key and a description of its options, which are opaque.
+// The order of the options is kept as the last filter wins.
+func cacheKey(row string, opts []bigtable.ReadOption) string {
+	var b strings.Builder
+	b.WriteString(row)
+	b.WriteByte(0)
+	for _, opt := range opts {
+		b.WriteString(inspect.Describe(opt))
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// rowSize estimates the memory used by a cached row.
+func rowSize(key string, row bigtable.Row) int {
+	size := len(key)
+	for family, items := range row {
+		size += len(family)
+		for _, item := range items {
+			size += len(item.Row) + len(item.Column) + len(item.Value) + cacheItemOverhead
+		}
+	}
+	return size
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+)
+
+// countingReadAdapter counts the calls to ReadRow and can hold them until release is closed.
+type countingReadAdapter struct {
+	mockAdapter
+	calls   int32
+	release chan struct{}
+}
+
+func (a *countingReadAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	atomic.AddInt32(&a.calls, 1)
+	if a.release != nil {
+		<-a.release
+	}
+	return a.mockAdapter.ReadRow(ctx, row, opts...)
+}
+
+func TestCachingAdapter_ReadRow(t *testing.T) {
+	ctx := context.Background()
+	adapter := &countingReadAdapter{}
+	cache := NewCachingAdapter(adapter, 1<<20, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.ReadRow(ctx, "contact-1"); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+	}
+	if _, err := cache.ReadRow(ctx, "contact-1", bigtable.RowFilter(bigtable.ColumnFilter("d"))); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err := cache.ReadRow(ctx, "contact-1", bigtable.RowFilter(bigtable.ValueFilter("d"))); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if adapter.calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", adapter.calls)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := cache.ReadRow(ctx, "contact-1"); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if adapter.calls != 4 {
+		t.Fatal("expected the expired row to be read again")
+	}
+
+	if _, err := cache.ApplyBulk(ctx, []string{"contact-1"}, []*bigtable.Mutation{bigtable.NewMutation()}); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if len(cache.entries) != 0 {
+		t.Fatalf("expected all the entries of the row to be invalidated, got %d", len(cache.entries))
+	}
+}
+
+func TestCachingAdapter_Eviction(t *testing.T) {
+	ctx := context.Background()
+	adapter := &countingReadAdapter{}
+	row, _ := adapter.mockAdapter.ReadRow(ctx, "contact-1")
+	// room for two rows only
+	size := rowSize(cacheKey("contact-1", nil), row)
+	cache := NewCachingAdapter(adapter, 2*size+size/2, 0)
+	for _, key := range []string{"contact-1", "contact-2", "contact-1", "contact-3"} {
+		if _, err := cache.ReadRow(ctx, key); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 {
+		t.Fatalf("expected 1 eviction, got %+v", stats)
+	}
+	if _, ok := cache.entries[cacheKey("contact-2", nil)]; ok {
+		t.Fatal("expected the least recently used row to be evicted")
+	}
+	if _, ok := cache.entries[cacheKey("contact-1", nil)]; !ok {
+		t.Fatal("expected the recently used row to be kept")
+	}
+	if cache.size > cache.maxBytes {
+		t.Fatalf("the cache exceeds its size: %d > %d", cache.size, cache.maxBytes)
+	}
+}
+
+func TestCachingAdapter_Singleflight(t *testing.T) {
+	ctx := context.Background()
+	adapter := &countingReadAdapter{release: make(chan struct{})}
+	cache := NewCachingAdapter(adapter, 1<<20, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if row, err := cache.ReadRow(ctx, "contact-1"); err != nil || row.Key() != "contact-1" {
+				t.Errorf("unexpected result %v %v", row, err)
+			}
+		}()
+	}
+	// let the readers join the call in progress
+	for atomic.LoadInt32(&adapter.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(adapter.release)
+	wg.Wait()
+	if adapter.calls != 1 {
+		t.Fatalf("expected a single call, got %d", adapter.calls)
+	}
+}
+
+// contextReadAdapter counts the calls to ReadRow and holds them until release is closed or their context is done.
+type contextReadAdapter struct {
+	mockAdapter
+	calls   int32
+	release chan struct{}
+}
+
+func (a *contextReadAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	atomic.AddInt32(&a.calls, 1)
+	select {
+	case <-a.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return a.mockAdapter.ReadRow(ctx, row, opts...)
+}
+
+func TestCachingAdapter_SingleflightCanceled(t *testing.T) {
+	adapter := &contextReadAdapter{release: make(chan struct{})}
+	cache := NewCachingAdapter(adapter, 1<<20, time.Minute)
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cache.ReadRow(leaderCtx, "contact-1")
+		leaderErr <- err
+	}()
+	for atomic.LoadInt32(&adapter.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	followerErr := make(chan error, 1)
+	go func() {
+		row, err := cache.ReadRow(context.Background(), "contact-1")
+		if err == nil && row.Key() != "contact-1" {
+			err = fmt.Errorf("unexpected row %v", row)
+		}
+		followerErr <- err
+	}()
+	// let the follower join the call in progress
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Fatalf("expected the leader to be canceled, got %v", err)
+	}
+	close(adapter.release)
+	if err := <-followerErr; err != nil {
+		t.Fatalf("expected the follower to read the row again, got %v", err)
+	}
+	if calls := atomic.LoadInt32(&adapter.calls); calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestCachingAdapterOption(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t), NewCachingAdapterOption(1<<20, time.Minute))
+	cache, ok := repo.adapter.(*CachingAdapter)
+	if !ok {
+		t.Fatalf("expected a CachingAdapter, got %T", repo.adapter)
+	}
+	eventSet, err := repo.Read(ctx, "contact-3")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err = repo.Read(ctx, "contact-3"); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if _, err = repo.Write(ctx, eventSet); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if _, err = repo.Read(ctx, "contact-3"); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if stats := cache.Stats(); stats.Misses != 2 {
+		t.Fatalf("expected the written row to be read again, got %+v", stats)
+	}
+}
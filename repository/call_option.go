@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/mapping"
+)
+
+// CallOption customizes a single call to one of the Repository methods.
+type CallOption interface {
+	applyCall(o *callOptions)
+}
+
+// callOptions gathers the settings of a single call.
+type callOptions struct {
+	filters []bigtable.Filter
+	columns []string
+	timeout *time.Duration
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt.applyCall(o)
+	}
+	return o
+}
+
+// filter chains the given filters with the ones of the call, returning nil when there is none.
+// The projected columns, if any, are translated into their short columns using the mapper.
+func (o *callOptions) filter(mapper *mapping.Mapper, filters ...bigtable.Filter) bigtable.Filter {
+	all := append(filters[:len(filters):len(filters)], o.filters...)
+	if len(o.columns) > 0 {
+		all = append(all, projectionFilter(mapper, o.columns))
+	}
+	switch len(all) {
+	case 0:
+		return nil
+	case 1:
+		return all[0]
+	default:
+		return bigtable.ChainFilters(all...)
+	}
+}
+
+// FamilyOption restricts a read to a single column family.
+type FamilyOption struct {
+	family string
+}
+
+func NewFamilyOption(family string) FamilyOption {
+	return FamilyOption{family: family}
+}
+
+func (o FamilyOption) applyCall(c *callOptions) {
+	c.filters = append(c.filters, bigtable.FamilyFilter(o.family))
+}
+
+// ColumnsOption restricts a read to the given mapped columns, so that the cells of the other columns are not transferred.
+type ColumnsOption struct {
+	columns []string
+}
+
+// NewColumnsOption returns a ColumnsOption keeping only the given columns, using their mapped names.
+// The columns from the "reversed" section of the mapping include all their short value columns,
+// the columns that are not part of the mapping are taken as they are.
+func NewColumnsOption(columns ...string) ColumnsOption {
+	return ColumnsOption{columns: columns}
+}
+
+func (o ColumnsOption) applyCall(c *callOptions) {
+	c.columns = append(c.columns, o.columns...)
+}
+
+// projectionFilter returns a bigtable.Filter keeping only the short columns of the given mapped columns.
+func projectionFilter(mapper *mapping.Mapper, columns []string) bigtable.Filter {
+	seen := make(map[string]bool)
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		shorts, ok := mapper.ShortColumns(column)
+		if !ok {
+			shorts = []string{column}
+		}
+		for _, short := range shorts {
+			if !seen[short] {
+				seen[short] = true
+				quoted = append(quoted, regexp.QuoteMeta(short))
+			}
+		}
+	}
+	sort.Strings(quoted)
+	return bigtable.ColumnFilter("^(" + strings.Join(quoted, "|") + ")$")
+}
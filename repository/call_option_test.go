@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"github.com/sendinblue/bigtable-access-layer/mapping"
+)
+
+func TestProjectionFilter(t *testing.T) {
+	jsonMapping, err := mapping.LoadMapping([]byte(`{
+		"raws": {"u": "url"},
+		"mapped": {"e": {"name": "event_type", "values": {"11": "page_view"}}},
+		"reversed": [{"name": "order_status", "values": {"1": "pending_payment", "3": "processing"}}]
+	}`))
+	if err != nil {
+		t.Fatalf("failed to load mapping: %v", err)
+	}
+	mapper := mapping.NewMapper(jsonMapping)
+	tests := []struct {
+		columns  []string
+		expected string
+	}{
+		{columns: []string{"event_type"}, expected: "^(e)$"},
+		{columns: []string{"event_type", "url", "event_type"}, expected: "^(e|u)$"},
+		{columns: []string{"order_status"}, expected: "^(1|3)$"},
+		{columns: []string{"url", "order_status", "unknown.column"}, expected: `^(1|3|u|unknown\.column)$`},
+	}
+	for _, test := range tests {
+		filter := projectionFilter(mapper, test.columns)
+		if expected := bigtable.ColumnFilter(test.expected); filter.String() != expected.String() {
+			t.Errorf("expected %s, got %s", expected, filter)
+		}
+	}
+}
+
+func TestRepository_ReadColumns(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t))
+	date := time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "contactp-1", Date: date, Cells: map[string]string{"event_type": "page_view", "device_type": "Computer", "url": "https://example.org/a"}},
+			{RowKey: "contactp-1", Date: date.Add(time.Hour), Cells: map[string]string{"event_type": "purchase", "device_type": "Computer", "url": "https://example.org/b"}},
+		},
+	}}
+	result, err := repo.Write(ctx, eventSet)
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	readSet, err := repo.Read(ctx, "contactp-1", NewColumnsOption("event_type", "url"))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(readSet.Events["front"]) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(readSet.Events["front"]))
+	}
+	for _, event := range readSet.Events["front"] {
+		if len(event.Cells) != 2 || event.Cells["event_type"] == "" || event.Cells["url"] == "" {
+			t.Fatalf("expected only event_type and url, got %v", event.Cells)
+		}
+	}
+
+	readSet, err = repo.ReadLast(ctx, "contactp-1", NewColumnsOption("device_type"))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(readSet.Events["front"]) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(readSet.Events["front"]))
+	}
+	if cells := readSet.Events["front"][0].Cells; len(cells) != 1 || cells["device_type"] != "Computer" {
+		t.Fatalf("expected only device_type, got %v", cells)
+	}
+
+	readSet, err = repo.ReadFamily(ctx, "contactp-1", "front", NewColumnsOption("url"))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	for _, event := range readSet.Events["front"] {
+		if len(event.Cells) != 1 || event.Cells["url"] == "" {
+			t.Fatalf("expected only url, got %v", event.Cells)
+		}
+	}
+}
+
+func TestRepository_SearchColumns(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t))
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"))
+
+	eventSet, err := repo.Search(ctx, bigtable.PrefixRange("contact-"), filter, NewColumnsOption("event_type"))
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(eventSet.Events["front"]) != 50 {
+		t.Fatalf("expected 50 events, got %d", len(eventSet.Events["front"]))
+	}
+	for _, event := range eventSet.Events["front"] {
+		if len(event.Cells) != 1 || event.Cells["event_type"] != "purchase" {
+			t.Fatalf("expected only event_type, got %v", event.Cells)
+		}
+	}
+
+	eventSet, err = repo.Search(ctx, bigtable.PrefixRange("contact-"), filter, NewColumnsOption("event_type"), NewFamilyOption("blog"))
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(eventSet.Events["front"]) != 0 {
+		t.Fatalf("expected no front event, got %d", len(eventSet.Events["front"]))
+	}
+
+	eventSet, _, err = repo.SearchPage(ctx, bigtable.PrefixRange("contact-"), filter, "", NewColumnsOption("url"))
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	for _, event := range eventSet.Events["front"] {
+		if len(event.Cells) != 1 || event.Cells["url"] == "" {
+			t.Fatalf("expected only url, got %v", event.Cells)
+		}
+	}
+
+	rows := 0
+	err = repo.SearchIter(ctx, bigtable.PrefixRange("contact-"), filter, func(set *data.Set) bool {
+		rows++
+		for _, event := range set.Events["front"] {
+			if len(event.Cells) != 1 || event.Cells["device_type"] == "" {
+				t.Fatalf("expected only device_type, got %v", event.Cells)
+			}
+		}
+		return true
+	}, NewColumnsOption("device_type"))
+	if err != nil || rows != 10 {
+		t.Fatalf("expected 10 rows, got %d %v", rows, err)
+	}
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+const (
+	// Big Table rejects the requests containing more than 100,000 mutations.
+	defaultMaxBulkEntries = 100000
+	// Big Table rejects the requests larger than 256MB, we keep a safe margin as the size is estimated.
+	defaultMaxBulkBytes = 64 << 20
+	// timestampSize is the size of the timestamp of a cell.
+	timestampSize = 8
+)
+
+// BulkLimitsOption sets the maximum number of cell mutations and the maximum estimated size in bytes of a single
+// ApplyBulk sent to Big Table by Write and DeleteEvents. Larger sets of events are split into several requests.
+type BulkLimitsOption struct {
+	maxEntries int
+	maxBytes   int
+}
+
+func NewBulkLimitsOption(maxEntries int, maxBytes int) BulkLimitsOption {
+	return BulkLimitsOption{maxEntries: maxEntries, maxBytes: maxBytes}
+}
+
+func (o BulkLimitsOption) apply(r *Repository) {
+	r.maxBulkEntries = o.maxEntries
+	r.maxBulkBytes = o.maxBytes
+}
+
+/*
+write splits the data.Set into chunks complying with the bulk limits, applies the mutations of each chunk and
+aggregates the results.
+
+A row carrying too many events is split across several chunks, so its events are not written atomically anymore.
+When a whole chunk fails, all its rows are reported as failed and the first of those errors is returned once all the
+chunks have been processed.
+*/
+func (r *Repository) write(ctx context.Context, eventSet *data.Set, toMutations func(*data.Set) map[string]*bigtable.Mutation) (*WriteResult, error) {
+	result := &WriteResult{}
+	var firstErr error
+	for _, chunk := range r.chunk(eventSet) {
+		events := groupByRow(chunk)
+		chunkResult, err := r.applyBulk(ctx, toMutations(chunk), events)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			for _, key := range sortedKeys(events) {
+				result.Failures = append(result.Failures, &WriteFailure{RowKey: key, Events: events[key], Err: err})
+			}
+			continue
+		}
+		result.Failures = append(result.Failures, chunkResult.Failures...)
+	}
+	return result, firstErr
+}
+
+// chunk splits the data.Set into several ones that don't exceed the bulk limits of the repository.
+// An event is never split, so an event exceeding the limits on its own ends up alone in its chunk.
+func (r *Repository) chunk(eventSet *data.Set) []*data.Set {
+	maxEntries, maxBytes := r.maxBulkEntries, r.maxBulkBytes
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxBulkEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBulkBytes
+	}
+	var chunks []*data.Set
+	var current *data.Set
+	var entries, bytes int
+	var rows map[string]bool
+	rowEvents := groupByRow(eventSet)
+	for _, key := range sortedKeys(rowEvents) {
+		families := rowEvents[key]
+		for _, family := range sortedFamilies(families) {
+			for _, event := range families[family] {
+				eventEntries, eventBytes := r.eventSize(family, event)
+				// the row key is sent once per row of the chunk
+				keyBytes := len(key)
+				if rows[key] {
+					keyBytes = 0
+				}
+				if current != nil && (entries+eventEntries > maxEntries || bytes+keyBytes+eventBytes > maxBytes) {
+					current = nil
+				}
+				if current == nil {
+					current = &data.Set{Events: make(map[string][]*data.Event), Columns: eventSet.Columns}
+					chunks = append(chunks, current)
+					entries, bytes, keyBytes = 0, 0, len(key)
+					rows = make(map[string]bool)
+				}
+				rows[key] = true
+				eventBytes += keyBytes
+				current.Events[family] = append(current.Events[family], event)
+				entries += eventEntries
+				bytes += eventBytes
+			}
+		}
+	}
+	return chunks
+}
+
+// eventSize estimates the number of cell mutations and the number of bytes needed to write the event.
+func (r *Repository) eventSize(family string, event *data.Event) (int, int) {
+	bytes := 0
+	for name, value := range event.Cells {
+		column, btValue := r.mapper.ToBigTable(name, value)
+		bytes += len(family) + len(column) + len(btValue) + timestampSize
+	}
+	return len(event.Cells), bytes
+}
+
+func sortedKeys(rows map[string]map[string][]*data.Event) []string {
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFamilies(families map[string][]*data.Event) []string {
+	names := make([]string, 0, len(families))
+	for family := range families {
+		names = append(names, family)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+var errBulk = errors.New("bulk failure")
+
+// countingBulkAdapter records the row keys of each ApplyBulk and fails the calls listed in failingCalls.
+type countingBulkAdapter struct {
+	mockAdapter
+	calls        [][]string
+	failingCalls map[int]bool
+}
+
+func (a *countingBulkAdapter) ApplyBulk(_ context.Context, rowKeys []string, _ []*bigtable.Mutation, _ ...bigtable.ApplyOption) (errs []error, err error) {
+	a.calls = append(a.calls, rowKeys)
+	if a.failingCalls[len(a.calls)] {
+		return nil, errBulk
+	}
+	return nil, nil
+}
+
+func getChunkedSet() *data.Set {
+	date := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	events := make([]*data.Event, 0)
+	for i := 0; i < 5; i++ {
+		events = append(events, &data.Event{
+			RowKey: "contact-1",
+			Date:   date.Add(time.Duration(i) * time.Minute),
+			Cells:  map[string]string{"event_type": "page_view", "device_type": "Computer"},
+		})
+	}
+	events = append(events, &data.Event{
+		RowKey: "contact-2",
+		Date:   date,
+		Cells:  map[string]string{"event_type": "purchase", "device_type": "Computer"},
+	})
+	return &data.Set{Events: map[string][]*data.Event{"front": events}}
+}
+
+func TestRepository_Chunk(t *testing.T) {
+	repository := &Repository{
+		adapter:        mockAdapter{},
+		mapper:         getMockMapper(t),
+		maxBulkEntries: 4,
+	}
+	chunks := repository.chunk(getChunkedSet())
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(chunks))
+	}
+	for _, chunk := range chunks {
+		entries := 0
+		for _, event := range chunk.Events["front"] {
+			entries += len(event.Cells)
+		}
+		if entries > 4 {
+			t.Fatalf("expected at most 4 entries per chunk, got %d", entries)
+		}
+	}
+
+	// each event weighs 2 * (5 bytes for the family + 1 byte for the column + 1 or 2 bytes for the value + 8 bytes for the timestamp)
+	repository = &Repository{
+		adapter:      mockAdapter{},
+		mapper:       getMockMapper(t),
+		maxBulkBytes: 80,
+	}
+	chunks = repository.chunk(getChunkedSet())
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(chunks))
+	}
+}
+
+func TestRepository_WriteChunks(t *testing.T) {
+	ctx := context.Background()
+	adapter := &countingBulkAdapter{failingCalls: map[int]bool{2: true}}
+	repository := &Repository{
+		adapter:        adapter,
+		mapper:         getMockMapper(t),
+		maxBulkEntries: 4,
+	}
+	result, err := repository.Write(ctx, getChunkedSet())
+	if err != errBulk {
+		t.Fatalf("expected errBulk, got %v", err)
+	}
+	if len(adapter.calls) != 3 {
+		t.Fatalf("expected 3 calls, got %d", len(adapter.calls))
+	}
+	if len(result.Failures) != 1 {
+		t.Fatalf("expected 1 failure, got %d", len(result.Failures))
+	}
+	if result.Failures[0].RowKey != "contact-1" || len(result.Failures[0].Events["front"]) != 2 {
+		t.Fatalf("unexpected failure %+v", result.Failures[0])
+	}
+}
+
+func TestRepository_WriteChunksEmulator(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t), NewBulkLimitsOption(3, 0))
+	set := getChunkedSet()
+	for _, event := range set.Events["front"] {
+		event.RowKey = "contactk-" + event.RowKey
+	}
+	result, err := repo.Write(ctx, set)
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+	readSet, err := repo.Read(ctx, "contactk-contact-1")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(readSet.Events["front"]) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(readSet.Events["front"]))
+	}
+}
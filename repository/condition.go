@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"github.com/sendinblue/bigtable-access-layer/mapping"
+)
+
+// Condition describes, using mapped column names and values, the state a row must be in for WriteIf to write into it.
+type Condition struct {
+	family string
+	column string
+	value  string
+	exists bool
+}
+
+// EventExists returns a Condition that holds when at least one event of the row has the given value for the given column.
+func EventExists(column string, value string) Condition {
+	return Condition{column: column, value: value, exists: true}
+}
+
+// NoEventExists returns a Condition that holds when no event of the row has the given value for the given column.
+func NoEventExists(column string, value string) Condition {
+	return Condition{column: column, value: value, exists: false}
+}
+
+// InFamily restricts the Condition to the events of a single column family.
+func (c Condition) InFamily(family string) Condition {
+	c.family = family
+	return c
+}
+
+// filter translates the condition into a bigtable.Filter matching the cells of the events described by the condition.
+func (c Condition) filter(mapper *mapping.Mapper) bigtable.Filter {
+	column, value := mapper.ToBigTable(c.column, c.value)
+	filters := make([]bigtable.Filter, 0, 3)
+	if c.family != "" {
+		filters = append(filters, bigtable.FamilyFilter(exactMatch(c.family)))
+	}
+	filters = append(filters, bigtable.ColumnFilter(exactMatch(column)), bigtable.ValueFilter(exactMatch(value)))
+	return bigtable.ChainFilters(filters...)
+}
+
+// exactMatch returns a regular expression matching exactly the given string.
+func exactMatch(s string) string {
+	return "^" + regexp.QuoteMeta(s) + "$"
+}
+
+/*
+WriteIf writes the events of the data.Set into the given row only if the condition holds, and reports whether it did.
+
+The check and the write are performed atomically by Big Table, so the condition can't change in between.
+All the events of the data.Set must belong to the given row.
+*/
+func (r *Repository) WriteIf(ctx context.Context, key string, condition Condition, eventSet *data.Set, opts ...CallOption) (written bool, err error) {
+	ctx, done := r.startOperation(ctx, operationWrite, "WriteIf", key, newCallOptions(opts))
+	defer done(&err)
+	if err = r.beforeWrite(ctx, eventSet); err != nil {
+		return false, err
+	}
+	mutations := r.mapper.GetMutations(eventSet)
+	for rowKey := range mutations {
+		if rowKey != key {
+			return false, errors.Errorf("event of row %s cannot be written conditionally to row %s", rowKey, key)
+		}
+	}
+	mutation, ok := mutations[key]
+	if !ok {
+		return false, errors.New("no event to write")
+	}
+	var mtrue, mfalse *bigtable.Mutation
+	if condition.exists {
+		mtrue = mutation
+	} else {
+		mfalse = mutation
+	}
+	matched, err := r.adapter.CheckAndMutate(ctx, key, condition.filter(r.mapper), mtrue, mfalse)
+	if err != nil {
+		return false, err
+	}
+	if matched != condition.exists {
+		return false, nil
+	}
+	return true, r.afterWrite(ctx, &WriteResult{})
+}
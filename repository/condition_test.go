@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+func TestRepository_WriteIf(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t))
+	purchase := func(minute int) *data.Set {
+		return &data.Set{Events: map[string][]*data.Event{
+			"front": {
+				{
+					RowKey: "contactc-1",
+					Date:   time.Date(2021, time.March, 1, 0, minute, 0, 0, time.UTC),
+					Cells:  map[string]string{"event_type": "purchase", "device_type": "Computer"},
+				},
+			},
+		}}
+	}
+
+	applied, err := repo.WriteIf(ctx, "contactc-1", NoEventExists("event_type", "purchase"), purchase(1))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if !applied {
+		t.Fatal("the first purchase should have been written")
+	}
+	applied, err = repo.WriteIf(ctx, "contactc-1", NoEventExists("event_type", "purchase"), purchase(2))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if applied {
+		t.Fatal("the second purchase should not have been written")
+	}
+	applied, err = repo.WriteIf(ctx, "contactc-1", EventExists("event_type", "purchase").InFamily("blog"), purchase(3))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if applied {
+		t.Fatal("there's no purchase in the blog family")
+	}
+	applied, err = repo.WriteIf(ctx, "contactc-1", EventExists("event_type", "purchase").InFamily("front"), purchase(4))
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if !applied {
+		t.Fatal("the purchase should have been written")
+	}
+
+	readSet, err := repo.Read(ctx, "contactc-1")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(readSet.Events["front"]) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(readSet.Events["front"]))
+	}
+
+	_, err = repo.WriteIf(ctx, "contactc-2", NoEventExists("event_type", "purchase"), purchase(5))
+	if err == nil {
+		t.Fatal("writing events of another row should fail")
+	}
+}
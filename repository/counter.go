@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+)
+
+/*
+Increment atomically adds delta to the counter stored in the given column and returns its new value.
+
+The column is the mapped name of the counter, it is translated into its short column using the mapping.
+Big Table stores counters as 64-bit big-endian signed integers and treats a missing cell as zero.
+*/
+func (r *Repository) Increment(ctx context.Context, key string, family string, column string, delta int64, opts ...CallOption) (value int64, err error) {
+	ctx, done := r.startOperation(ctx, operationWrite, "Increment", key, newCallOptions(opts))
+	defer done(&err)
+	short := column
+	if columns, ok := r.mapper.ShortColumns(column); ok {
+		if len(columns) != 1 {
+			return 0, errors.Errorf("column %s is stored in %d columns and can't be used as a counter", column, len(columns))
+		}
+		short = columns[0]
+	}
+	rmw := bigtable.NewReadModifyWrite()
+	rmw.Increment(family, short, delta)
+	row, err := r.adapter.ApplyReadModifyWrite(ctx, key, rmw)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range row[family] {
+		if removeFamily(item.Column) != short {
+			continue
+		}
+		if len(item.Value) != 8 {
+			return 0, errors.Errorf("invalid counter value of %d bytes in column %s", len(item.Value), column)
+		}
+		return int64(binary.BigEndian.Uint64(item.Value)), nil
+	}
+	return 0, errors.Errorf("counter %s not returned by Big Table", column)
+}
+
+// removeFamily removes the column family from a column qualifier such as "family:column".
+func removeFamily(column string) string {
+	if i := strings.IndexByte(column, ':'); i >= 0 {
+		return column[i+1:]
+	}
+	return column
+}
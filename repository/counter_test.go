@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sendinblue/bigtable-access-layer/mapping"
+)
+
+func TestRepository_Increment(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	jsonMapping, err := mapping.LoadMapping([]byte(`{"raws": {"pv": "page_views"}, "reversed": [{"name": "order_status", "values": {"1": "pending", "2": "completed"}}]}`))
+	if err != nil {
+		t.Fatalf("failed to load mapping: %v", err)
+	}
+	repo := NewRepository(client.Open(table), mapping.NewMapper(jsonMapping))
+
+	value, err := repo.Increment(ctx, "contacti-1", "front", "page_views", 3)
+	if err != nil {
+		t.Fatalf("failed to increment: %v", err)
+	}
+	if value != 3 {
+		t.Fatalf("expected 3, got %d", value)
+	}
+	value, err = repo.Increment(ctx, "contacti-1", "front", "page_views", -1)
+	if err != nil {
+		t.Fatalf("failed to increment: %v", err)
+	}
+	if value != 2 {
+		t.Fatalf("expected 2, got %d", value)
+	}
+
+	row, err := client.Open(table).ReadRow(ctx, "contacti-1")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if row["front"][0].Column != "front:pv" {
+		t.Fatalf("expected the counter to be stored in front:pv, got %s", row["front"][0].Column)
+	}
+
+	value, err = repo.Increment(ctx, "contacti-1", "front", "clicks", 1)
+	if err != nil {
+		t.Fatalf("failed to increment: %v", err)
+	}
+	if value != 1 {
+		t.Fatalf("expected 1, got %d", value)
+	}
+
+	if _, err = repo.Increment(ctx, "contacti-1", "front", "order_status", 1); err == nil {
+		t.Fatal("a reversed column can't be used as a counter")
+	}
+}
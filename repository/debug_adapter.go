@@ -9,6 +9,9 @@ import (
 	"cloud.google.com/go/bigtable"
 )
 
+// DebugAdapter prints a line before and after each call of the adapter it wraps.
+//
+// Deprecated: the lines can't be parsed reliably, use the LoggingAdapter instead.
 type DebugAdapter struct {
 	writer  io.Writer
 	adapter Adapter
@@ -58,3 +61,21 @@ func (a DebugAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*b
 	_, _ = fmt.Fprintf(a.writer, "%s: ApplyBulk(): %s, errored items: %v ,error is %v\n", time.Now().UTC().String(), end.Sub(start), len(errs), err)
 	return errs, err
 }
+
+func (a DebugAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	_, _ = fmt.Fprintf(a.writer, "%s: CheckAndMutate(%s, %s)\n", time.Now().UTC().String(), row, cond)
+	start := time.Now()
+	matched, err = a.adapter.CheckAndMutate(ctx, row, cond, mtrue, mfalse)
+	end := time.Now()
+	_, _ = fmt.Fprintf(a.writer, "%s: CheckAndMutate(%s): %s, matched is %v, error is %v\n", time.Now().UTC().String(), row, end.Sub(start), matched, err)
+	return matched, err
+}
+
+func (a DebugAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	_, _ = fmt.Fprintf(a.writer, "%s: ApplyReadModifyWrite(%s)\n", time.Now().UTC().String(), row)
+	start := time.Now()
+	btRow, err := a.adapter.ApplyReadModifyWrite(ctx, row, m)
+	end := time.Now()
+	_, _ = fmt.Fprintf(a.writer, "%s: ApplyReadModifyWrite(%s): %s, error is %v\n", time.Now().UTC().String(), row, end.Sub(start), err)
+	return btRow, err
+}
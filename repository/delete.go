@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// DeleteEvents deletes the events contained in the data.Set from the repository.
+// Only the cells matching the columns and the timestamp of each event are deleted, the other events of the rows are kept.
+// Like Write, it returns the rows that could not be processed and an error if the whole operation failed.
+func (r *Repository) DeleteEvents(ctx context.Context, eventSet *data.Set, opts ...CallOption) (result *WriteResult, err error) {
+	ctx, done := r.startOperation(ctx, operationWrite, "DeleteEvents", firstRowKey(eventSet), newCallOptions(opts))
+	defer done(&err)
+	return r.write(ctx, eventSet, r.mapper.GetDeleteMutations)
+}
+
+// DeleteRow deletes a whole row from the repository, whatever its column families.
+func (r *Repository) DeleteRow(ctx context.Context, key string, opts ...CallOption) (err error) {
+	ctx, done := r.startOperation(ctx, operationWrite, "DeleteRow", key, newCallOptions(opts))
+	defer done(&err)
+	mutation := bigtable.NewMutation()
+	mutation.DeleteRow()
+	return r.applyRow(ctx, key, mutation)
+}
+
+// DeleteFamily deletes all the cells of a column family in the given row.
+func (r *Repository) DeleteFamily(ctx context.Context, key string, family string, opts ...CallOption) (err error) {
+	ctx, done := r.startOperation(ctx, operationWrite, "DeleteFamily", key, newCallOptions(opts))
+	defer done(&err)
+	mutation := bigtable.NewMutation()
+	mutation.DeleteCellsInFamily(family)
+	return r.applyRow(ctx, key, mutation)
+}
+
+// applyRow applies a mutation to a single row through the adapter so that decorators see it as any other write.
+func (r *Repository) applyRow(ctx context.Context, key string, mutation *bigtable.Mutation) error {
+	errs, err := r.adapter.ApplyBulk(ctx, []string{key}, []*bigtable.Mutation{mutation})
+	if err != nil {
+		return err
+	}
+	for _, e := range errs {
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
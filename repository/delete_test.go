@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+func TestRepository_Delete(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	dbgWriter := debugWriter{}
+	repo := NewRepository(client.Open(table), getMockMapper(t), NewDebugAdapterOption(&dbgWriter))
+	date := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	purchase := &data.Event{RowKey: "contactd-1", Date: date.Add(2 * time.Minute), Cells: map[string]string{"event_type": "purchase", "device_type": "Computer"}}
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "contactd-1", Date: date, Cells: map[string]string{"event_type": "page_view", "device_type": "Computer"}},
+			{RowKey: "contactd-1", Date: date.Add(time.Minute), Cells: map[string]string{"event_type": "add_to_cart", "device_type": "Computer"}},
+			purchase,
+		},
+		"blog": {
+			{RowKey: "contactd-1", Date: date, Cells: map[string]string{"event_type": "page_view"}},
+		},
+	}}
+	result, err := repo.Write(ctx, eventSet)
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	result, err = repo.DeleteEvents(ctx, &data.Set{Events: map[string][]*data.Event{"front": {purchase}}})
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to delete events: %v %v", err, result.Errors())
+	}
+	readSet, err := repo.Read(ctx, "contactd-1")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(readSet.Events["front"]) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(readSet.Events["front"]))
+	}
+	for _, event := range readSet.Events["front"] {
+		if event.Cells["event_type"] == "purchase" {
+			t.Fatal("the purchase event should have been deleted")
+		}
+	}
+
+	if err := repo.DeleteFamily(ctx, "contactd-1", "blog"); err != nil {
+		t.Fatalf("failed to delete family: %v", err)
+	}
+	readSet, err = repo.Read(ctx, "contactd-1")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, ok := readSet.Events["blog"]; ok {
+		t.Fatal("the blog family should have been deleted")
+	}
+	if len(readSet.Events["front"]) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(readSet.Events["front"]))
+	}
+
+	if err := repo.DeleteRow(ctx, "contactd-1"); err != nil {
+		t.Fatalf("failed to delete row: %v", err)
+	}
+	if _, err = repo.Read(ctx, "contactd-1"); err != ErrRowNotFound {
+		t.Fatalf("expected ErrRowNotFound, got %v", err)
+	}
+
+	// 1 write, 3 deletes and 3 reads, each of them logging 2 lines
+	if len(dbgWriter.lines) != 14 {
+		t.Fatalf("expected 14 lines, got %d", len(dbgWriter.lines))
+	}
+}
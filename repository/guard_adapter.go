@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/internal/inspect"
+	"google.golang.org/grpc/codes"
+)
+
+// GuardConfig describes the rate limits and the circuit breaker of the GuardAdapter.
+type GuardConfig struct {
+	// ReadRowsPerSecond limits the number of rows read per second. Zero means no limit.
+	ReadRowsPerSecond float64
+	// WriteRowsPerSecond limits the number of rows written per second. Zero means no limit.
+	WriteRowsPerSecond float64
+	// WriteMutationsPerSecond limits the number of cell mutations written per second. Zero means no limit.
+	WriteMutationsPerSecond float64
+	// BreakerThreshold is the number of consecutive failures opening the circuit. Zero disables the circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is the time the circuit stays open before a probe call is let through.
+	BreakerCooldown time.Duration
+	// BreakerCodes are the gRPC codes of the errors counted as failures by the circuit breaker.
+	BreakerCodes []codes.Code
+}
+
+// DefaultGuardConfig returns a GuardConfig without rate limits, opening the circuit for 10 seconds after
+// 5 consecutive Unavailable or DeadlineExceeded errors.
+func DefaultGuardConfig() GuardConfig {
+	return GuardConfig{
+		BreakerThreshold: 5,
+		BreakerCooldown:  10 * time.Second,
+		BreakerCodes:     []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+	}
+}
+
+// CircuitOpenError is returned by the GuardAdapter without calling Big Table while its circuit is open.
+type CircuitOpenError struct {
+	// Until is the time at which a probe call will be let through.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open until %s", e.Until.Format(time.RFC3339Nano))
+}
+
+/*
+GuardAdapter is an Adapter protecting the cluster from the calls of the adapter it wraps.
+
+The rows read, the rows written and the cell mutations written are limited by token buckets holding one second of
+their rate, the calls wait for the tokens they need. ReadRows takes the tokens row by row, as they are streamed.
+
+The circuit breaker opens after BreakerThreshold consecutive calls failed with one of the BreakerCodes. While it is
+open, the calls fail fast with a *CircuitOpenError. Once BreakerCooldown has elapsed, a single probe call is let
+through: the circuit closes if it succeeds and opens again otherwise. Only the error of the call is considered, the
+errors of the entries of ApplyBulk are not.
+*/
+type GuardAdapter struct {
+	adapter        Adapter
+	readRows       *tokenBucket
+	writeRows      *tokenBucket
+	writeMutations *tokenBucket
+	breaker        *circuitBreaker
+}
+
+func NewGuardAdapter(adapter Adapter, config GuardConfig) *GuardAdapter {
+	return &GuardAdapter{
+		adapter:        adapter,
+		readRows:       newTokenBucket(config.ReadRowsPerSecond, time.Now, sleep),
+		writeRows:      newTokenBucket(config.WriteRowsPerSecond, time.Now, sleep),
+		writeMutations: newTokenBucket(config.WriteMutationsPerSecond, time.Now, sleep),
+		breaker: &circuitBreaker{
+			threshold: config.BreakerThreshold,
+			cooldown:  config.BreakerCooldown,
+			codes:     config.BreakerCodes,
+			now:       time.Now,
+		},
+	}
+}
+
+type GuardAdapterOption struct {
+	config GuardConfig
+}
+
+func NewGuardAdapterOption(config GuardConfig) *GuardAdapterOption {
+	return &GuardAdapterOption{
+		config: config,
+	}
+}
+
+func (opt *GuardAdapterOption) apply(repo *Repository) {
+	repo.adapter = NewGuardAdapter(repo.adapter, opt.config)
+}
+
+func (a *GuardAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	var btRow bigtable.Row
+	err := a.guard(ctx, func() error {
+		var err error
+		btRow, err = a.adapter.ReadRow(ctx, row, opts...)
+		return err
+	}, a.readRows.take(1))
+	return btRow, err
+}
+
+func (a *GuardAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	var waitErr error
+	err = a.guard(ctx, func() error {
+		return a.adapter.ReadRows(ctx, arg, func(row bigtable.Row) bool {
+			if waitErr = a.readRows.take(1)(ctx); waitErr != nil {
+				return false
+			}
+			return f(row)
+		}, opts...)
+	})
+	if waitErr != nil {
+		return waitErr
+	}
+	return err
+}
+
+func (a *GuardAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) (errs []error, err error) {
+	mutations := 0
+	for _, m := range muts {
+		ops, err := inspect.MutationOps(m)
+		if err != nil {
+			return nil, err
+		}
+		mutations += len(ops)
+	}
+	err = a.guard(ctx, func() error {
+		var err error
+		errs, err = a.adapter.ApplyBulk(ctx, rowKeys, muts, opts...)
+		return err
+	}, a.writeRows.take(len(rowKeys)), a.writeMutations.take(mutations))
+	return errs, err
+}
+
+func (a *GuardAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	trueOps, err := inspect.MutationOps(mtrue)
+	if err != nil {
+		return false, err
+	}
+	falseOps, err := inspect.MutationOps(mfalse)
+	if err != nil {
+		return false, err
+	}
+	mutations := len(trueOps) + len(falseOps)
+	err = a.guard(ctx, func() error {
+		var err error
+		matched, err = a.adapter.CheckAndMutate(ctx, row, cond, mtrue, mfalse)
+		return err
+	}, a.writeRows.take(1), a.writeMutations.take(mutations))
+	return matched, err
+}
+
+func (a *GuardAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	rules, err := inspect.ReadModifyWriteRules(m)
+	if err != nil {
+		return nil, err
+	}
+	var btRow bigtable.Row
+	err = a.guard(ctx, func() error {
+		var err error
+		btRow, err = a.adapter.ApplyReadModifyWrite(ctx, row, m)
+		return err
+	}, a.writeRows.take(1), a.writeMutations.take(len(rules)))
+	return btRow, err
+}
+
+// guard checks the circuit breaker, waits for the tokens needed by the call, then makes the call and reports its
+// outcome to the circuit breaker.
+func (a *GuardAdapter) guard(ctx context.Context, call func() error, waits ...func(ctx context.Context) error) error {
+	probe, err := a.breaker.allow()
+	if err != nil {
+		return err
+	}
+	for _, wait := range waits {
+		if err := wait(ctx); err != nil {
+			a.breaker.abort(probe)
+			return err
+		}
+	}
+	err = call()
+	a.breaker.record(err, probe)
+	return err
+}
+
+// tokenBucket is a token bucket holding one second of its rate. A nil tokenBucket has no limit.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func newTokenBucket(rate float64, now func() time.Time, sleep func(ctx context.Context, d time.Duration) error) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: rate, tokens: math.Max(rate, 1), last: now(), now: now, sleep: sleep}
+}
+
+// take returns a function waiting for n tokens. The tokens are reserved right away, so that the calls are served in
+// order and a call needing more tokens than the bucket holds only waits for the missing ones. They are given back if
+// the context is done before the end of the wait.
+func (b *tokenBucket) take(n int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if b == nil || n <= 0 {
+			return nil
+		}
+		b.mu.Lock()
+		now := b.now()
+		b.tokens = math.Min(math.Max(b.rate, 1), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		b.tokens -= float64(n)
+		missing := -b.tokens
+		b.mu.Unlock()
+		if missing <= 0 {
+			return nil
+		}
+		if err := b.sleep(ctx, time.Duration(missing/b.rate*float64(time.Second))); err != nil {
+			b.mu.Lock()
+			b.tokens += float64(n)
+			b.mu.Unlock()
+			return err
+		}
+		return nil
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker counts the consecutive failures of the calls and decides whether the next ones are let through.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	codes     []codes.Code
+	now       func() time.Time
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+// allow returns an error if the call must fail fast, and whether the call is the probe of a half-open circuit.
+func (b *circuitBreaker) allow() (bool, error) {
+	if b.threshold <= 0 {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until := b.openedAt.Add(b.cooldown)
+	switch {
+	case b.state == circuitClosed:
+		return false, nil
+	case b.state == circuitOpen && b.now().Before(until):
+		return false, &CircuitOpenError{Until: until}
+	case b.probing:
+		return false, &CircuitOpenError{Until: until}
+	default:
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true, nil
+	}
+}
+
+// record updates the state of the circuit with the outcome of a call.
+func (b *circuitBreaker) record(err error, probe bool) {
+	if b.threshold <= 0 {
+		return
+	}
+	code := errorCode(err)
+	failed := false
+	for _, c := range b.codes {
+		if c == code {
+			failed = true
+			break
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case probe && code == codes.Canceled:
+		b.probing = false
+	case probe && failed:
+		b.state, b.openedAt, b.probing = circuitOpen, b.now(), false
+	case probe:
+		b.state, b.failures, b.probing = circuitClosed, 0, false
+	case b.state != circuitClosed || code == codes.Canceled:
+		// the calls started before the circuit opened don't change its state
+	case failed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.state, b.openedAt = circuitOpen, b.now()
+		}
+	default:
+		b.failures = 0
+	}
+}
+
+// abort lets another call probe the circuit when the probe has been given up before being made.
+func (b *circuitBreaker) abort(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
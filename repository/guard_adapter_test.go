@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClock is a clock that only moves when sleeping.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(_ context.Context, d time.Duration) error {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func newTestGuardAdapter(adapter Adapter, config GuardConfig) (*GuardAdapter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)}
+	guard := NewGuardAdapter(adapter, config)
+	guard.readRows = newTokenBucket(config.ReadRowsPerSecond, clock.Now, clock.Sleep)
+	guard.writeRows = newTokenBucket(config.WriteRowsPerSecond, clock.Now, clock.Sleep)
+	guard.writeMutations = newTokenBucket(config.WriteMutationsPerSecond, clock.Now, clock.Sleep)
+	guard.breaker.now = clock.Now
+	return guard, clock
+}
+
+func TestGuardAdapter_RateLimits(t *testing.T) {
+	ctx := context.Background()
+	config := GuardConfig{ReadRowsPerSecond: 2, WriteRowsPerSecond: 100, WriteMutationsPerSecond: 4}
+	adapter := &faultyAdapter{keys: []string{"contact-1", "contact-2", "contact-3", "contact-4"}, readRowsFailAfter: -1}
+	guard, clock := newTestGuardAdapter(adapter, config)
+
+	// the bucket holds 2 rows, the 2 next rows wait for half a second each
+	rows := 0
+	err := guard.ReadRows(ctx, bigtable.PrefixRange("contact-"), func(row bigtable.Row) bool {
+		rows++
+		return true
+	})
+	if err != nil || rows != 4 {
+		t.Fatalf("expected 4 rows, got %d %v", rows, err)
+	}
+	if len(clock.sleeps) != 2 || clock.sleeps[0] != 500*time.Millisecond || clock.sleeps[1] != 500*time.Millisecond {
+		t.Fatalf("unexpected waits %v", clock.sleeps)
+	}
+
+	// 3 rows of 2 mutations need 6 of the 4 mutation tokens, the rows are limited separately
+	mut := bigtable.NewMutation()
+	mut.Set("front", "e", bigtable.Now(), []byte("11"))
+	mut.Set("front", "d", bigtable.Now(), []byte("1"))
+	clock.sleeps = nil
+	guard.adapter = mockAdapter{}
+	if _, err := guard.ApplyBulk(ctx, []string{"a", "b", "c"}, []*bigtable.Mutation{mut, mut, mut}); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 500*time.Millisecond {
+		t.Fatalf("unexpected waits %v", clock.sleeps)
+	}
+	if _, err := guard.ReadRow(ctx, "contact-1"); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(clock.sleeps) != 1 {
+		t.Fatalf("the reads should not wait for the write tokens, got %v", clock.sleeps)
+	}
+}
+
+func TestGuardAdapter_CircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	notFound := status.Error(codes.NotFound, "not found")
+	adapter := &faultyAdapter{readRowErrs: []error{unavailable, notFound, unavailable, unavailable, unavailable, unavailable, nil}}
+	config := DefaultGuardConfig()
+	config.BreakerThreshold = 3
+	config.BreakerCooldown = time.Second
+	guard, clock := newTestGuardAdapter(adapter, config)
+
+	// a non-matching error resets the count of consecutive failures
+	for _, expected := range []codes.Code{codes.Unavailable, codes.NotFound, codes.Unavailable, codes.Unavailable, codes.Unavailable} {
+		if _, err := guard.ReadRow(ctx, "contact-1"); status.Code(err) != expected {
+			t.Fatalf("expected %s, got %v", expected, err)
+		}
+	}
+	_, err := guard.ReadRow(ctx, "contact-1")
+	openErr, ok := err.(*CircuitOpenError)
+	if !ok {
+		t.Fatalf("expected a CircuitOpenError, got %v", err)
+	}
+	if !openErr.Until.Equal(clock.now.Add(time.Second)) {
+		t.Fatalf("unexpected end of the open state %s", openErr.Until)
+	}
+	if len(adapter.readRowErrs) != 2 {
+		t.Fatalf("the open circuit should not call the adapter")
+	}
+
+	// the probe fails, the circuit opens again
+	clock.now = clock.now.Add(time.Second)
+	if _, err := guard.ReadRow(ctx, "contact-1"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the probe to fail, got %v", err)
+	}
+	if _, err := guard.ReadRow(ctx, "contact-1"); err == nil {
+		t.Fatal("expected the circuit to be open")
+	}
+
+	// the probe succeeds, the circuit closes
+	clock.now = clock.now.Add(time.Second)
+	if _, err := guard.ReadRow(ctx, "contact-1"); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	if _, err := guard.ReadRow(ctx, "contact-1"); err != nil {
+		t.Fatalf("expected the circuit to be closed, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	now := time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+	breaker := &circuitBreaker{
+		threshold: 1,
+		cooldown:  time.Second,
+		codes:     []codes.Code{codes.DeadlineExceeded},
+		now:       func() time.Time { return now },
+	}
+	breaker.record(context.DeadlineExceeded, false)
+	now = now.Add(time.Second)
+	probe, err := breaker.allow()
+	if !probe || err != nil {
+		t.Fatalf("expected a probe, got %v %v", probe, err)
+	}
+	if _, err := breaker.allow(); err == nil {
+		t.Fatal("only one probe should be let through")
+	}
+	breaker.abort(probe)
+	if probe, err = breaker.allow(); !probe || err != nil {
+		t.Fatalf("expected another probe, got %v %v", probe, err)
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+/*
+Hook is called by the Repository before and after reading or writing events, at the level of the data.Set.
+
+The read hooks are called by the Read methods, ReadMany (for each row), Search, SearchPage and SearchIter (for each
+row). The write hooks are called by Write and WriteIf, and therefore by the BufferedWriter too.
+
+  - BeforeRead receives the name of the operation and its row key, or the first one when it spans several rows. For
+    Search, SearchPage and SearchIter, it is the first key of a bigtable.RowList or the description of the first
+    bigtable.RowRange.
+  - AfterRead receives the events read, which it may modify, for instance to enrich them.
+  - BeforeWrite receives the events about to be written, which it may modify, for instance to validate and stamp them.
+  - AfterWrite is called once the write has been sent, with the rows that could not be written if any.
+
+The hooks registered with NewHookOption are called in order. An error returned by a hook aborts the operation: the
+following hooks are not called and the error is returned to the caller. Embed NopHook to implement only some of the
+methods.
+*/
+type Hook interface {
+	BeforeRead(ctx context.Context, operation string, key string) error
+	AfterRead(ctx context.Context, eventSet *data.Set) error
+	BeforeWrite(ctx context.Context, eventSet *data.Set) error
+	AfterWrite(ctx context.Context, result *WriteResult) error
+}
+
+// NopHook is a Hook doing nothing, to be embedded by the hooks that only need some of the methods.
+type NopHook struct{}
+
+func (NopHook) BeforeRead(context.Context, string, string) error {
+	return nil
+}
+
+func (NopHook) AfterRead(context.Context, *data.Set) error {
+	return nil
+}
+
+func (NopHook) BeforeWrite(context.Context, *data.Set) error {
+	return nil
+}
+
+func (NopHook) AfterWrite(context.Context, *WriteResult) error {
+	return nil
+}
+
+// HookOption registers hooks on the repository, after the ones already registered.
+type HookOption struct {
+	hooks []Hook
+}
+
+func NewHookOption(hooks ...Hook) HookOption {
+	return HookOption{hooks: hooks}
+}
+
+func (o HookOption) apply(r *Repository) {
+	r.hooks = append(r.hooks, o.hooks...)
+}
+
+func (r *Repository) beforeRead(ctx context.Context, operation string, key string) error {
+	for _, hook := range r.hooks {
+		if err := hook.BeforeRead(ctx, operation, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// beforeScan calls beforeRead with the key of the bigtable.RowSet, only computed when there are hooks to call.
+func (r *Repository) beforeScan(ctx context.Context, operation string, rowSet bigtable.RowSet) error {
+	if len(r.hooks) == 0 {
+		return nil
+	}
+	return r.beforeRead(ctx, operation, rowSetKey(rowSet))
+}
+
+func (r *Repository) afterRead(ctx context.Context, eventSet *data.Set) error {
+	for _, hook := range r.hooks {
+		if err := hook.AfterRead(ctx, eventSet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) beforeWrite(ctx context.Context, eventSet *data.Set) error {
+	for _, hook := range r.hooks {
+		if err := hook.BeforeWrite(ctx, eventSet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) afterWrite(ctx context.Context, result *WriteResult) error {
+	for _, hook := range r.hooks {
+		if err := hook.AfterWrite(ctx, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// recordingHook records its calls and fails the ones whose name is listed in failures.
+type recordingHook struct {
+	name     string
+	calls    *[]string
+	failures map[string]bool
+}
+
+func (h recordingHook) record(call string) error {
+	*h.calls = append(*h.calls, h.name+"."+call)
+	if h.failures[call] {
+		return fmt.Errorf("%s failed", call)
+	}
+	return nil
+}
+
+func (h recordingHook) BeforeRead(_ context.Context, operation string, key string) error {
+	return h.record("BeforeRead " + operation + " " + key)
+}
+
+func (h recordingHook) AfterRead(_ context.Context, eventSet *data.Set) error {
+	for _, events := range eventSet.Events {
+		for _, event := range events {
+			event.Cells["enriched_by"] = h.name
+		}
+	}
+	return h.record("AfterRead")
+}
+
+func (h recordingHook) BeforeWrite(_ context.Context, _ *data.Set) error {
+	return h.record("BeforeWrite")
+}
+
+func (h recordingHook) AfterWrite(_ context.Context, result *WriteResult) error {
+	return h.record(fmt.Sprintf("AfterWrite %d", len(result.Failures)))
+}
+
+// stampHook only implements BeforeWrite, stamping the events with the given device.
+type stampHook struct {
+	NopHook
+	device string
+}
+
+func (h stampHook) BeforeWrite(_ context.Context, eventSet *data.Set) error {
+	for _, events := range eventSet.Events {
+		for _, event := range events {
+			if event.Cells["event_type"] == "" {
+				return errors.New("missing event type")
+			}
+			event.Cells["device_type"] = h.device
+		}
+	}
+	return nil
+}
+
+func TestRepository_Hooks(t *testing.T) {
+	ctx := context.Background()
+	var calls []string
+	first := recordingHook{name: "first", calls: &calls}
+	second := recordingHook{name: "second", calls: &calls}
+	repo := NewRepositoryWithAdapter(mockAdapter{}, getMockMapper(t), NewHookOption(first), NewHookOption(second))
+
+	eventSet, err := repo.Read(ctx, "contact-1")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	for _, event := range eventSet.Events["front"] {
+		if event.Cells["enriched_by"] != "second" {
+			t.Fatalf("expected the events to be enriched by the last hook, got %v", event.Cells)
+		}
+	}
+	if _, err = repo.Search(ctx, bigtable.PrefixRange("contact-"), bigtable.PassAllFilter()); err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if _, err = repo.Write(ctx, eventSet); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	expected := []string{
+		"first.BeforeRead Read contact-1", "second.BeforeRead Read contact-1", "first.AfterRead", "second.AfterRead",
+		`first.BeforeRead Search ["contact-","contact.")`, `second.BeforeRead Search ["contact-","contact.")`, "first.AfterRead", "second.AfterRead",
+		"first.BeforeWrite", "second.BeforeWrite", "first.AfterWrite 0", "second.AfterWrite 0",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestRepository_HookAbort(t *testing.T) {
+	ctx := context.Background()
+	var calls []string
+	failing := recordingHook{name: "failing", calls: &calls, failures: map[string]bool{"BeforeRead Read contact-1": true}}
+	skipped := recordingHook{name: "skipped", calls: &calls}
+	adapter := &countingReadAdapter{}
+	repo := NewRepositoryWithAdapter(adapter, getMockMapper(t), NewHookOption(failing, skipped))
+
+	if _, err := repo.Read(ctx, "contact-1"); err == nil || err.Error() != "BeforeRead Read contact-1 failed" {
+		t.Fatalf("expected the error of the hook, got %v", err)
+	}
+	if adapter.calls != 0 {
+		t.Fatalf("the row should not have been read")
+	}
+	if len(calls) != 1 {
+		t.Fatalf("the following hooks should not have been called, got %v", calls)
+	}
+}
+
+func TestRepository_HookBeforeWrite(t *testing.T) {
+	ctx := context.Background()
+	adapter := &countingBulkAdapter{}
+	repo := NewRepositoryWithAdapter(adapter, getMockMapper(t), NewHookOption(stampHook{device: "Computer"}))
+	date := time.Date(2021, time.July, 1, 0, 0, 0, 0, time.UTC)
+
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {{RowKey: "contact-1", Date: date, Cells: map[string]string{"event_type": "purchase"}}},
+	}}
+	if _, err := repo.Write(ctx, eventSet); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if eventSet.Events["front"][0].Cells["device_type"] != "Computer" {
+		t.Fatalf("expected the event to be stamped, got %v", eventSet.Events["front"][0].Cells)
+	}
+
+	invalid := &data.Set{Events: map[string][]*data.Event{
+		"front": {{RowKey: "contact-1", Date: date, Cells: map[string]string{"url": "https://example.org"}}},
+	}}
+	if _, err := repo.Write(ctx, invalid); err == nil {
+		t.Fatal("expected the write to be rejected by the hook")
+	}
+	if written, err := repo.WriteIf(ctx, "contact-1", NoEventExists("event_type", "purchase"), invalid); err == nil || written {
+		t.Fatal("expected the conditional write to be rejected by the hook")
+	}
+	if len(adapter.calls) != 1 {
+		t.Fatalf("expected only the valid event to be written, got %d calls", len(adapter.calls))
+	}
+}
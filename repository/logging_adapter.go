@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+)
+
+// LogLevel is the severity of a log entry.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Logger receives the structured entries of the LoggingAdapter. It can be implemented on top of any logging library.
+type Logger interface {
+	Log(level LogLevel, msg string, fields map[string]interface{})
+}
+
+// JSONLogger is a Logger writing each entry as a JSON object on its own line.
+type JSONLogger struct {
+	mu     sync.Mutex
+	writer io.Writer
+	now    func() time.Time
+}
+
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{writer: w, now: time.Now}
+}
+
+func (l *JSONLogger) Log(level LogLevel, msg string, fields map[string]interface{}) {
+	entry := make(map[string]interface{}, len(fields)+3)
+	for name, value := range fields {
+		entry[name] = value
+	}
+	entry["time"] = l.now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.writer.Write(append(line, '\n'))
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a copy of the context carrying the correlation id logged by the LoggingAdapter.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation id carried by the context, if any.
+func CorrelationID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+	return id, ok
+}
+
+// LoggingConfig describes what the LoggingAdapter logs.
+type LoggingConfig struct {
+	// Level is the minimum level of the logged entries. Successful calls are logged at LevelInfo, calls with failed
+	// entries at LevelWarn and failed calls at LevelError.
+	Level LogLevel
+	// SampleRate is the fraction of the successful calls that are logged, between 0 and 1. Failures are always logged.
+	// Zero or less means the default rate of 1: raise Level to LevelWarn not to log the successful calls at all.
+	SampleRate float64
+	// MaxKeys is the maximum number of row keys listed in an entry. Zero means the default of 10 keys and a negative
+	// value that no key is listed.
+	MaxKeys int
+	// RedactKey, if set, is applied to the row keys before they are logged.
+	RedactKey func(key string) string
+}
+
+// DefaultLoggingConfig returns a LoggingConfig logging all the calls at LevelInfo with up to 10 row keys in clear.
+func DefaultLoggingConfig() LoggingConfig {
+	return LoggingConfig{
+		Level:      LevelInfo,
+		SampleRate: 1,
+		MaxKeys:    10,
+	}
+}
+
+// HashKey is a LoggingConfig.RedactKey function replacing a row key by the beginning of its SHA-256 hash, so the
+// entries related to the same row can still be matched.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+/*
+LoggingAdapter is an Adapter that logs the calls of the adapter it wraps as structured entries with the following fields:
+  - operation and table
+  - key_count and keys: the number of row keys, or of rows returned by ReadRows, and a sample of them, possibly redacted
+  - duration_ms and error
+  - failed_count and first_failure for ApplyBulk, matched for CheckAndMutate
+  - correlation_id when the context carries one, see WithCorrelationID
+*/
+type LoggingAdapter struct {
+	adapter Adapter
+	logger  Logger
+	table   string
+	config  LoggingConfig
+	random  func() float64
+}
+
+// NewLoggingAdapter creates a LoggingAdapter, applying the defaults of DefaultLoggingConfig to the zero values of
+// the configuration.
+func NewLoggingAdapter(adapter Adapter, table string, logger Logger, config LoggingConfig) *LoggingAdapter {
+	defaults := DefaultLoggingConfig()
+	if config.SampleRate <= 0 {
+		config.SampleRate = defaults.SampleRate
+	}
+	if config.MaxKeys == 0 {
+		config.MaxKeys = defaults.MaxKeys
+	}
+	if config.MaxKeys < 0 {
+		config.MaxKeys = 0
+	}
+	return &LoggingAdapter{
+		adapter: adapter,
+		logger:  logger,
+		table:   table,
+		config:  config,
+		random:  rand.Float64, // #nosec G404 -- the sampling doesn't need a secure random generator
+	}
+}
+
+type LoggingAdapterOption struct {
+	table  string
+	logger Logger
+	config LoggingConfig
+}
+
+func NewLoggingAdapterOption(table string, logger Logger, config LoggingConfig) *LoggingAdapterOption {
+	return &LoggingAdapterOption{
+		table:  table,
+		logger: logger,
+		config: config,
+	}
+}
+
+func (opt *LoggingAdapterOption) apply(repo *Repository) {
+	repo.adapter = NewLoggingAdapter(repo.adapter, opt.table, opt.logger, opt.config)
+}
+
+func (a *LoggingAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	start := time.Now()
+	btRow, err := a.adapter.ReadRow(ctx, row, opts...)
+	a.log(ctx, "ReadRow", []string{row}, 1, start, err, 0, nil)
+	return btRow, err
+}
+
+func (a *LoggingAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	var keys []string
+	count := 0
+	start := time.Now()
+	err = a.adapter.ReadRows(ctx, arg, func(row bigtable.Row) bool {
+		if len(keys) < a.config.MaxKeys {
+			keys = append(keys, row.Key())
+		}
+		count++
+		return f(row)
+	}, opts...)
+	a.log(ctx, "ReadRows", keys, count, start, err, 0, nil)
+	return err
+}
+
+func (a *LoggingAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) (errs []error, err error) {
+	start := time.Now()
+	errs, err = a.adapter.ApplyBulk(ctx, rowKeys, muts, opts...)
+	failed := 0
+	var firstErr error
+	for _, e := range errs {
+		if e != nil {
+			if firstErr == nil {
+				firstErr = e
+			}
+			failed++
+		}
+	}
+	fields := map[string]interface{}{"failed_count": failed}
+	if firstErr != nil {
+		fields["first_failure"] = firstErr.Error()
+	}
+	a.log(ctx, "ApplyBulk", rowKeys, len(rowKeys), start, err, failed, fields)
+	return errs, err
+}
+
+func (a *LoggingAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	start := time.Now()
+	matched, err = a.adapter.CheckAndMutate(ctx, row, cond, mtrue, mfalse)
+	a.log(ctx, "CheckAndMutate", []string{row}, 1, start, err, 0, map[string]interface{}{"matched": matched})
+	return matched, err
+}
+
+func (a *LoggingAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	start := time.Now()
+	btRow, err := a.adapter.ApplyReadModifyWrite(ctx, row, m)
+	a.log(ctx, "ApplyReadModifyWrite", []string{row}, 1, start, err, 0, nil)
+	return btRow, err
+}
+
+/*
+log sends the entry of a call to the logger if its level is enabled and, for the successful calls, if it is sampled.
+keys may only hold a part of the keyCount row keys of the call, failed is the number of entries that failed on their own.
+*/
+func (a *LoggingAdapter) log(ctx context.Context, operation string, keys []string, keyCount int, start time.Time, err error, failed int, fields map[string]interface{}) {
+	duration := time.Since(start)
+	level := LevelInfo
+	switch {
+	case err != nil:
+		level = LevelError
+	case failed > 0:
+		level = LevelWarn
+	}
+	if level < a.config.Level {
+		return
+	}
+	if level == LevelInfo && a.random() >= a.config.SampleRate {
+		return
+	}
+	entry := map[string]interface{}{
+		"operation":   operation,
+		"table":       a.table,
+		"key_count":   keyCount,
+		"keys":        a.sampleKeys(keys),
+		"duration_ms": float64(duration) / float64(time.Millisecond),
+	}
+	for name, value := range fields {
+		entry[name] = value
+	}
+	if err != nil {
+		entry["error"] = err.Error()
+	}
+	if id, ok := CorrelationID(ctx); ok {
+		entry["correlation_id"] = id
+	}
+	a.logger.Log(level, operation, entry)
+}
+
+// sampleKeys returns the first keys, up to MaxKeys, redacted if required.
+func (a *LoggingAdapter) sampleKeys(keys []string) []string {
+	if len(keys) > a.config.MaxKeys {
+		keys = keys[:a.config.MaxKeys]
+	}
+	sample := make([]string, len(keys))
+	for i, key := range keys {
+		if a.config.RedactKey != nil {
+			key = a.config.RedactKey(key)
+		}
+		sample[i] = key
+	}
+	return sample
+}
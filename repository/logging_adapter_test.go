@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigtable"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type memoryLogger struct {
+	levels  []LogLevel
+	entries []map[string]interface{}
+}
+
+func (l *memoryLogger) Log(level LogLevel, _ string, fields map[string]interface{}) {
+	l.levels = append(l.levels, level)
+	l.entries = append(l.entries, fields)
+}
+
+func TestLoggingAdapter(t *testing.T) {
+	ctx := WithCorrelationID(context.Background(), "request-42")
+	client := getBigTableClient(ctx)
+	logger := &memoryLogger{}
+	config := DefaultLoggingConfig()
+	config.MaxKeys = 3
+	repo := NewRepository(client.Open(table), getMockMapper(t), NewLoggingAdapterOption(table, logger, config))
+
+	if _, err := repo.Read(ctx, "contact-3"); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err := repo.Search(ctx, bigtable.PrefixRange("contact-"), bigtable.LatestNFilter(1)); err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(logger.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(logger.entries))
+	}
+	read := logger.entries[0]
+	if read["operation"] != "ReadRow" || read["table"] != table || read["correlation_id"] != "request-42" || read["key_count"] != 1 {
+		t.Fatalf("unexpected entry %v", read)
+	}
+	search := logger.entries[1]
+	if search["key_count"] != 10 || len(search["keys"].([]string)) != 3 {
+		t.Fatalf("expected 10 rows and 3 sampled keys, got %v", search)
+	}
+}
+
+func TestLoggingAdapter_LevelAndSampling(t *testing.T) {
+	ctx := context.Background()
+	logger := &memoryLogger{}
+	config := DefaultLoggingConfig()
+	config.SampleRate = 0.5
+	config.RedactKey = HashKey
+	adapter := NewLoggingAdapter(&faultyAdapter{readRowErrs: []error{nil, nil, status.Error(codes.Unavailable, "unavailable")}}, table, logger, config)
+	samples := []float64{0.2, 0.7, 0.9}
+	adapter.random = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+	for i := 0; i < 3; i++ {
+		_, _ = adapter.ReadRow(ctx, "contact-1")
+	}
+	if len(logger.entries) != 2 {
+		t.Fatalf("expected the sampled call and the failure to be logged, got %d entries", len(logger.entries))
+	}
+	if logger.levels[1] != LevelError || logger.entries[1]["error"] == nil {
+		t.Fatalf("expected an error entry, got %v", logger.entries[1])
+	}
+	if keys := logger.entries[0]["keys"].([]string); keys[0] != HashKey("contact-1") {
+		t.Fatalf("expected a redacted key, got %v", keys)
+	}
+
+	logger = &memoryLogger{}
+	config.Level = LevelWarn
+	adapter = NewLoggingAdapter(&faultyAdapter{bulkErrs: func(_ int, rowKeys []string) []error {
+		return []error{nil, status.Error(codes.InvalidArgument, "invalid")}
+	}}, table, logger, config)
+	_, _ = adapter.ApplyBulk(ctx, []string{"ok", "invalid"}, make([]*bigtable.Mutation, 2))
+	if len(logger.entries) != 1 || logger.levels[0] != LevelWarn || logger.entries[0]["failed_count"] != 1 {
+		t.Fatalf("expected a warning for the failed entry, got %v", logger.entries)
+	}
+}
+
+func TestLoggingAdapter_ZeroConfig(t *testing.T) {
+	ctx := context.Background()
+	logger := &memoryLogger{}
+	adapter := NewLoggingAdapter(mockAdapter{}, table, logger, LoggingConfig{})
+	_, _ = adapter.ApplyBulk(ctx, []string{"a", "b"}, make([]*bigtable.Mutation, 2))
+	if len(logger.entries) != 1 || len(logger.entries[0]["keys"].([]string)) != 2 {
+		t.Fatalf("expected the successful call to be logged with its keys, got %v", logger.entries)
+	}
+
+	logger = &memoryLogger{}
+	adapter = NewLoggingAdapter(mockAdapter{}, table, logger, LoggingConfig{MaxKeys: -1})
+	_, _ = adapter.ApplyBulk(ctx, []string{"a", "b"}, make([]*bigtable.Mutation, 2))
+	if len(logger.entries) != 1 || len(logger.entries[0]["keys"].([]string)) != 0 {
+		t.Fatalf("expected an entry without keys, got %v", logger.entries)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONLogger(&buf)
+	logger.Log(LevelWarn, "ApplyBulk", map[string]interface{}{"key_count": 2, "keys": []string{"a", "b"}})
+	logger.Log(LevelInfo, "ReadRow", nil)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON line %s: %v", lines[0], err)
+	}
+	if entry["level"] != "warn" || entry["msg"] != "ApplyBulk" || entry["key_count"] != float64(2) || entry["time"] == nil {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+}
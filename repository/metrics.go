@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// MetricsRecorder receives the measures taken by the MetricsAdapter.
+type MetricsRecorder interface {
+	// ObserveCall records a call to an operation of the adapter, along with its gRPC code and its latency.
+	ObserveCall(operation string, table string, code codes.Code, latency time.Duration)
+	// ObserveFailedEntry records an entry of a bulk operation that failed although the call itself succeeded, along
+	// with its gRPC code.
+	ObserveFailedEntry(operation string, table string, code codes.Code)
+	// AddCells records the rows, cells and bytes read or written by an operation in a column family.
+	AddCells(operation string, table string, family string, rows int, cells int, bytes int)
+}
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the latency histograms of the PrometheusRecorder.
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type callKey struct {
+	operation, table string
+	code             codes.Code
+}
+
+type latencyKey struct {
+	operation, table string
+}
+
+type volumeKey struct {
+	operation, table, family string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+/*
+PrometheusRecorder is an in-process MetricsRecorder that keeps counters and latency histograms in memory and exposes
+them in the Prometheus text format, so they can be scraped without any extra dependency.
+
+It serves the following metrics:
+  - bigtable_access_calls_total: calls by operation, table and gRPC code
+  - bigtable_access_failed_entries_total: failed entries of the bulk calls by operation, table and gRPC code
+  - bigtable_access_call_duration_seconds: latency histogram by operation and table
+  - bigtable_access_rows_total, bigtable_access_cells_total and bigtable_access_bytes_total: volume read or written by operation, table and column family
+*/
+type PrometheusRecorder struct {
+	mu        sync.Mutex
+	buckets   []float64
+	calls     map[callKey]uint64
+	entries   map[callKey]uint64
+	latencies map[latencyKey]*histogram
+	rows      map[volumeKey]uint64
+	cells     map[volumeKey]uint64
+	bytes     map[volumeKey]uint64
+}
+
+// NewPrometheusRecorder creates a PrometheusRecorder using the given latency buckets, or DefaultLatencyBuckets if none is given.
+func NewPrometheusRecorder(buckets ...float64) *PrometheusRecorder {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &PrometheusRecorder{
+		buckets:   sorted,
+		calls:     make(map[callKey]uint64),
+		entries:   make(map[callKey]uint64),
+		latencies: make(map[latencyKey]*histogram),
+		rows:      make(map[volumeKey]uint64),
+		cells:     make(map[volumeKey]uint64),
+		bytes:     make(map[volumeKey]uint64),
+	}
+}
+
+func (p *PrometheusRecorder) ObserveCall(operation string, table string, code codes.Code, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls[callKey{operation: operation, table: table, code: code}]++
+	key := latencyKey{operation: operation, table: table}
+	h, ok := p.latencies[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(p.buckets))}
+		p.latencies[key] = h
+	}
+	seconds := latency.Seconds()
+	for i, bound := range p.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (p *PrometheusRecorder) ObserveFailedEntry(operation string, table string, code codes.Code) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries[callKey{operation: operation, table: table, code: code}]++
+}
+
+func (p *PrometheusRecorder) AddCells(operation string, table string, family string, rows int, cells int, bytes int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := volumeKey{operation: operation, table: table, family: family}
+	p.rows[key] += uint64(rows)
+	p.cells[key] += uint64(cells)
+	p.bytes[key] += uint64(bytes)
+}
+
+// ServeHTTP writes all the metrics using the Prometheus text exposition format.
+func (p *PrometheusRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = p.Write(w)
+}
+
+// Write writes all the metrics to w using the Prometheus text exposition format.
+func (p *PrometheusRecorder) Write(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+
+	writeCodes(&b, "bigtable_access_calls_total", "Number of calls to Big Table by operation, table and gRPC code.", p.calls)
+	writeCodes(&b, "bigtable_access_failed_entries_total", "Number of failed entries of the bulk calls to Big Table by operation, table and gRPC code.", p.entries)
+
+	b.WriteString("# HELP bigtable_access_call_duration_seconds Latency of the calls to Big Table by operation and table.\n")
+	b.WriteString("# TYPE bigtable_access_call_duration_seconds histogram\n")
+	latencyKeys := make([]latencyKey, 0, len(p.latencies))
+	for key := range p.latencies {
+		latencyKeys = append(latencyKeys, key)
+	}
+	sort.Slice(latencyKeys, func(i, j int) bool {
+		if latencyKeys[i].operation != latencyKeys[j].operation {
+			return latencyKeys[i].operation < latencyKeys[j].operation
+		}
+		return latencyKeys[i].table < latencyKeys[j].table
+	})
+	for _, key := range latencyKeys {
+		h := p.latencies[key]
+		labels := fmt.Sprintf("operation=%s,table=%s", quote(key.operation), quote(key.table))
+		for i, bound := range p.buckets {
+			fmt.Fprintf(&b, "bigtable_access_call_duration_seconds_bucket{%s,le=%s} %d\n", labels, quote(strconv.FormatFloat(bound, 'g', -1, 64)), h.counts[i])
+		}
+		fmt.Fprintf(&b, "bigtable_access_call_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "bigtable_access_call_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "bigtable_access_call_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	writeVolume(&b, "bigtable_access_rows_total", "Number of rows read or written by operation, table and column family.", p.rows)
+	writeVolume(&b, "bigtable_access_cells_total", "Number of cells read or written by operation, table and column family.", p.cells)
+	writeVolume(&b, "bigtable_access_bytes_total", "Number of bytes read or written by operation, table and column family.", p.bytes)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeCodes(b *strings.Builder, name string, help string, values map[callKey]uint64) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", name)
+	keys := make([]callKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		if keys[i].table != keys[j].table {
+			return keys[i].table < keys[j].table
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, key := range keys {
+		fmt.Fprintf(b, "%s{operation=%s,table=%s,code=%s} %d\n", name, quote(key.operation), quote(key.table), quote(key.code.String()), values[key])
+	}
+}
+
+func writeVolume(b *strings.Builder, name string, help string, values map[volumeKey]uint64) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", name)
+	keys := make([]volumeKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		if keys[i].table != keys[j].table {
+			return keys[i].table < keys[j].table
+		}
+		return keys[i].family < keys[j].family
+	})
+	for _, key := range keys {
+		fmt.Fprintf(b, "%s{operation=%s,table=%s,family=%s} %d\n", name, quote(key.operation), quote(key.table), quote(key.family), values[key])
+	}
+}
+
+// quote quotes a label value as expected by the Prometheus text format.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
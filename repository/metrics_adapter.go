@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	"github.com/sendinblue/bigtable-access-layer/internal/inspect"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsAdapter is an Adapter that reports the calls of the adapter it wraps to a MetricsRecorder: their gRPC code,
+// their latency, the gRPC code of the entries of ApplyBulk that failed, and the rows, cells and bytes read or written
+// in each column family.
+type MetricsAdapter struct {
+	adapter  Adapter
+	table    string
+	recorder MetricsRecorder
+}
+
+func NewMetricsAdapter(adapter Adapter, table string, recorder MetricsRecorder) *MetricsAdapter {
+	return &MetricsAdapter{
+		adapter:  adapter,
+		table:    table,
+		recorder: recorder,
+	}
+}
+
+type MetricsAdapterOption struct {
+	table    string
+	recorder MetricsRecorder
+}
+
+// NewMetricsAdapterOption reports the calls of the repository to the recorder, labelled with the given table name.
+func NewMetricsAdapterOption(table string, recorder MetricsRecorder) *MetricsAdapterOption {
+	return &MetricsAdapterOption{
+		table:    table,
+		recorder: recorder,
+	}
+}
+
+func (opt *MetricsAdapterOption) apply(repo *Repository) {
+	repo.adapter = NewMetricsAdapter(repo.adapter, opt.table, opt.recorder)
+}
+
+// cellVolume accumulates the rows, cells and bytes of a column family.
+type cellVolume struct {
+	rows, cells, bytes int
+}
+
+func (a *MetricsAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	start := time.Now()
+	btRow, err := a.adapter.ReadRow(ctx, row, opts...)
+	a.recorder.ObserveCall("ReadRow", a.table, errorCode(err), time.Since(start))
+	volumes := make(map[string]*cellVolume)
+	addRow(volumes, btRow)
+	a.addCells("ReadRow", volumes)
+	return btRow, err
+}
+
+func (a *MetricsAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	volumes := make(map[string]*cellVolume)
+	start := time.Now()
+	err = a.adapter.ReadRows(ctx, arg, func(row bigtable.Row) bool {
+		addRow(volumes, row)
+		return f(row)
+	}, opts...)
+	a.recorder.ObserveCall("ReadRows", a.table, errorCode(err), time.Since(start))
+	a.addCells("ReadRows", volumes)
+	return err
+}
+
+// ApplyBulk reports the code of each entry that failed, and the cells set by the mutations that have been applied
+// successfully.
+func (a *MetricsAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) (errs []error, err error) {
+	ops := make([][]*btpb.Mutation, len(muts))
+	for i, mut := range muts {
+		if ops[i], err = inspect.MutationOps(mut); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	errs, err = a.adapter.ApplyBulk(ctx, rowKeys, muts, opts...)
+	a.recorder.ObserveCall("ApplyBulk", a.table, errorCode(err), time.Since(start))
+	if err != nil {
+		return errs, err
+	}
+	volumes := make(map[string]*cellVolume)
+	for i := range muts {
+		if i < len(errs) && errs[i] != nil {
+			a.recorder.ObserveFailedEntry("ApplyBulk", a.table, errorCode(errs[i]))
+			continue
+		}
+		families := make(map[string]bool)
+		for _, op := range ops[i] {
+			setCell := op.GetSetCell()
+			if setCell == nil {
+				continue
+			}
+			volume := familyVolume(volumes, setCell.FamilyName)
+			if !families[setCell.FamilyName] {
+				families[setCell.FamilyName] = true
+				volume.rows++
+			}
+			volume.cells++
+			volume.bytes += len(setCell.ColumnQualifier) + len(setCell.Value)
+		}
+	}
+	a.addCells("ApplyBulk", volumes)
+	return errs, err
+}
+
+func (a *MetricsAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	start := time.Now()
+	matched, err = a.adapter.CheckAndMutate(ctx, row, cond, mtrue, mfalse)
+	a.recorder.ObserveCall("CheckAndMutate", a.table, errorCode(err), time.Since(start))
+	return matched, err
+}
+
+func (a *MetricsAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	start := time.Now()
+	btRow, err := a.adapter.ApplyReadModifyWrite(ctx, row, m)
+	a.recorder.ObserveCall("ApplyReadModifyWrite", a.table, errorCode(err), time.Since(start))
+	return btRow, err
+}
+
+func (a *MetricsAdapter) addCells(operation string, volumes map[string]*cellVolume) {
+	for family, volume := range volumes {
+		a.recorder.AddCells(operation, a.table, family, volume.rows, volume.cells, volume.bytes)
+	}
+}
+
+// addRow adds the cells of a row to the volumes of their column family. The bytes are the ones of the qualifiers and the values.
+func addRow(volumes map[string]*cellVolume, row bigtable.Row) {
+	for family, items := range row {
+		volume := familyVolume(volumes, family)
+		volume.rows++
+		volume.cells += len(items)
+		for _, item := range items {
+			volume.bytes += len(strings.TrimPrefix(item.Column, family+":")) + len(item.Value)
+		}
+	}
+}
+
+func familyVolume(volumes map[string]*cellVolume, family string) *cellVolume {
+	volume, ok := volumes[family]
+	if !ok {
+		volume = &cellVolume{}
+		volumes[family] = volume
+	}
+	return volume
+}
+
+// errorCode returns the gRPC code of an error, the errors of the context being mapped to their gRPC equivalent.
+func errorCode(err error) codes.Code {
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	default:
+		return status.Code(err)
+	}
+}
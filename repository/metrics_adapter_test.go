@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetricsAdapter(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	recorder := NewPrometheusRecorder()
+	repo := NewRepository(client.Open(table), getMockMapper(t), NewMetricsAdapterOption(table, recorder))
+
+	if _, err := repo.Read(ctx, "contact-3"); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err := repo.Search(ctx, bigtable.PrefixRange("contact-"), bigtable.ColumnFilter("e")); err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	eventSet, err := repo.Read(ctx, "contact-4")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	result, err := repo.Write(ctx, eventSet)
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	recorder.mu.Lock()
+	readRow := recorder.calls[callKey{operation: "ReadRow", table: table, code: codes.OK}]
+	readVolume := recorder.cells[volumeKey{operation: "ReadRow", table: table, family: "front"}]
+	bulkRows := recorder.rows[volumeKey{operation: "ApplyBulk", table: table, family: "front"}]
+	bulkCells := recorder.cells[volumeKey{operation: "ApplyBulk", table: table, family: "front"}]
+	recorder.mu.Unlock()
+	if readRow < 2 {
+		t.Fatalf("expected at least 2 ReadRow calls, got %d", readRow)
+	}
+	// each of the 100 events of the row holds 3 cells
+	if readVolume < 600 {
+		t.Fatalf("expected at least 600 cells read, got %d", readVolume)
+	}
+	if bulkRows != 1 || bulkCells != 300 {
+		t.Fatalf("expected 300 cells written in 1 row, got %d cells in %d rows", bulkCells, bulkRows)
+	}
+}
+
+func TestMetricsAdapter_ErrorCode(t *testing.T) {
+	ctx := context.Background()
+	recorder := NewPrometheusRecorder()
+	adapter := NewMetricsAdapter(&faultyAdapter{readRowErrs: []error{status.Error(codes.Unavailable, "unavailable")}}, "events", recorder)
+	if _, err := adapter.ReadRow(ctx, "contact-1"); err == nil {
+		t.Fatal("expected an error")
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	adapter = NewMetricsAdapter(&faultyAdapter{readRowErrs: []error{canceled.Err()}}, "events", recorder)
+	if _, err := adapter.ReadRow(canceled, "contact-1"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if recorder.calls[callKey{operation: "ReadRow", table: "events", code: codes.Unavailable}] != 1 {
+		t.Fatal("expected the Unavailable error to be counted")
+	}
+	if recorder.calls[callKey{operation: "ReadRow", table: "events", code: codes.Canceled}] != 1 {
+		t.Fatal("expected the canceled context to be counted as Canceled")
+	}
+}
+
+func TestMetricsAdapter_FailedEntries(t *testing.T) {
+	ctx := context.Background()
+	recorder := NewPrometheusRecorder()
+	adapter := NewMetricsAdapter(&faultyAdapter{bulkErrs: func(int, []string) []error {
+		return []error{nil, status.Error(codes.Unavailable, "unavailable"), status.Error(codes.InvalidArgument, "invalid")}
+	}}, "events", recorder)
+	muts := make([]*bigtable.Mutation, 3)
+	for i := range muts {
+		muts[i] = bigtable.NewMutation()
+		muts[i].Set("front", "d", bigtable.Now(), []byte("1"))
+	}
+	errs, err := adapter.ApplyBulk(ctx, []string{"contact-1", "contact-2", "contact-3"}, muts)
+	if err != nil || len(errs) != 3 {
+		t.Fatalf("expected the errors of the entries, got %v %v", errs, err)
+	}
+	if recorder.calls[callKey{operation: "ApplyBulk", table: "events", code: codes.OK}] != 1 {
+		t.Fatal("expected the call to be counted as OK")
+	}
+	if recorder.entries[callKey{operation: "ApplyBulk", table: "events", code: codes.Unavailable}] != 1 {
+		t.Fatal("expected the Unavailable entry to be counted")
+	}
+	if recorder.entries[callKey{operation: "ApplyBulk", table: "events", code: codes.InvalidArgument}] != 1 {
+		t.Fatal("expected the InvalidArgument entry to be counted")
+	}
+	if recorder.rows[volumeKey{operation: "ApplyBulk", table: "events", family: "front"}] != 1 {
+		t.Fatal("expected only the row applied successfully to be counted")
+	}
+}
+
+func TestPrometheusRecorder_ServeHTTP(t *testing.T) {
+	recorder := NewPrometheusRecorder(0.1, 1)
+	recorder.ObserveCall("ReadRow", "events", codes.OK, 50*time.Millisecond)
+	recorder.ObserveCall("ReadRow", "events", codes.OK, 500*time.Millisecond)
+	recorder.ObserveCall("ReadRow", "events", codes.NotFound, 2*time.Second)
+	recorder.AddCells("ReadRow", "events", `fr"ont`, 1, 3, 42)
+	recorder.ObserveFailedEntry("ApplyBulk", "events", codes.Unavailable)
+
+	response := httptest.NewRecorder()
+	recorder.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(response.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %s", response.Header().Get("Content-Type"))
+	}
+	body := response.Body.String()
+	for _, line := range []string{
+		`bigtable_access_calls_total{operation="ReadRow",table="events",code="OK"} 2`,
+		`bigtable_access_calls_total{operation="ReadRow",table="events",code="NotFound"} 1`,
+		`bigtable_access_failed_entries_total{operation="ApplyBulk",table="events",code="Unavailable"} 1`,
+		`bigtable_access_call_duration_seconds_bucket{operation="ReadRow",table="events",le="0.1"} 1`,
+		`bigtable_access_call_duration_seconds_bucket{operation="ReadRow",table="events",le="1"} 2`,
+		`bigtable_access_call_duration_seconds_bucket{operation="ReadRow",table="events",le="+Inf"} 3`,
+		`bigtable_access_call_duration_seconds_count{operation="ReadRow",table="events"} 3`,
+		`bigtable_access_rows_total{operation="ReadRow",table="events",family="fr\"ont"} 1`,
+		`bigtable_access_cells_total{operation="ReadRow",table="events",family="fr\"ont"} 3`,
+		`bigtable_access_bytes_total{operation="ReadRow",table="events",family="fr\"ont"} 42`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("expected the line %s in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// pageToken is the position of the last event returned by SearchPage.
+type pageToken struct {
+	Key       string             `json:"k"`
+	Timestamp bigtable.Timestamp `json:"t"`
+}
+
+/*
+SearchPage searches for rows in the repository that match the given filter and returns a single page of results along
+with an opaque continuation token.
+
+The page size is the maximum number of rows of the repository (see NewMaxRowsOption) and it is pushed down to Big Table,
+along with the next row which tells whether another page follows.
+The returned token encodes the row key and the timestamp of the last event of the page: calling SearchPage again with the
+same row set, the same filter and this token resumes the search right after this event, so the events already
+returned are never returned twice.
+An empty token starts the search from the beginning and an empty token is returned once the last page is reached.
+Like with Search, the options restrict the events returned without changing the rows matched by the filter.
+*/
+func (r *Repository) SearchPage(ctx context.Context, rowSet bigtable.RowSet, filter bigtable.Filter, token string, opts ...CallOption) (eventSet *data.Set, next string, err error) {
+	o := newCallOptions(opts)
+	ctx, done := r.startScan(ctx, "SearchPage", rowSet, o)
+	defer done(&err)
+	if err = r.beforeScan(ctx, "SearchPage", rowSet); err != nil {
+		return nil, "", err
+	}
+	from, err := decodePageToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+	pageSize := r.maxRows
+	if pageSize <= 0 {
+		pageSize = defaultMaxRows
+	}
+	// one more row is read to know whether another page follows
+	limit := pageSize + 1
+	if from != nil {
+		rowSet, err = retainRowsFrom(rowSet, from.Key)
+		if err != nil {
+			return nil, "", err
+		}
+		// the row of the previous token is read again in case it still has events to return
+		limit++
+	}
+	var (
+		result []bigtable.Row
+		last   *pageToken
+		more   bool
+	)
+	err = r.searchRows(ctx, rowSet, filter, o, func(key string, timestamps []bigtable.Timestamp, fullRow bigtable.Row) bool {
+		if from != nil && key == from.Key {
+			timestamps = olderThan(timestamps, from.Timestamp)
+		}
+		if len(timestamps) == 0 {
+			return true
+		}
+		if len(result) == pageSize {
+			more = true
+			return false
+		}
+		result = append(result, filterReadItems(fullRow, timestamps))
+		last = &pageToken{Key: key, Timestamp: oldest(timestamps)}
+		return true
+	}, bigtable.LimitRows(int64(limit)))
+	if err != nil {
+		return nil, "", err
+	}
+	if more {
+		next, err = encodePageToken(last)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	eventSet = buildEventSet(result, r.mapper)
+	if err = r.afterRead(ctx, eventSet); err != nil {
+		return nil, "", err
+	}
+	return eventSet, next, nil
+}
+
+func encodePageToken(token *pageToken) (string, error) {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return "", errors.Wrap(err, "encode page token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodePageToken(token string) (*pageToken, error) {
+	if token == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode page token")
+	}
+	t := &pageToken{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, errors.Wrap(err, "decode page token")
+	}
+	return t, nil
+}
+
+// olderThan returns the timestamps strictly older than the given one.
+func olderThan(timestamps []bigtable.Timestamp, ts bigtable.Timestamp) []bigtable.Timestamp {
+	result := make([]bigtable.Timestamp, 0, len(timestamps))
+	for _, t := range timestamps {
+		if t < ts {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func oldest(timestamps []bigtable.Timestamp) bigtable.Timestamp {
+	sorted := append([]bigtable.Timestamp(nil), timestamps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[0]
+}
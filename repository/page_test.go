@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigtable"
+)
+
+func TestRepository_SearchPage(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repository := NewRepository(client.Open(table), getMockMapper(t), NewMaxRowsOption(4))
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"))
+
+	seen := make(map[string]int)
+	pages := 0
+	token := ""
+	for {
+		eventSet, next, err := repository.SearchPage(ctx, bigtable.PrefixRange("contact-"), filter, token)
+		if err != nil {
+			t.Fatalf("failed to search: %v", err)
+		}
+		pages++
+		keys := make(map[string]bool)
+		for _, event := range eventSet.Events["front"] {
+			keys[event.RowKey] = true
+			seen[event.RowKey]++
+			if event.Cells["event_type"] != "purchase" {
+				t.Fatalf("expected purchase, got %s", event.Cells["event_type"])
+			}
+		}
+		if len(keys) > 4 {
+			t.Fatalf("expected at most 4 rows per page, got %d", len(keys))
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	if pages != 3 {
+		t.Fatalf("expected 3 pages, got %d", pages)
+	}
+	if len(seen) != 10 {
+		t.Fatalf("expected 10 rows, got %d", len(seen))
+	}
+	for key, count := range seen {
+		if count != 5 {
+			t.Fatalf("expected 5 events for %s, got %d", key, count)
+		}
+	}
+}
+
+func TestRepository_SearchPageLastFull(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repository := NewRepository(client.Open(table), getMockMapper(t), NewMaxRowsOption(4))
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"))
+	// contact-1, contact-10 and contact-2 to contact-7
+	rowSet := bigtable.NewRange("contact-1", "contact-8")
+
+	eventSet, next, err := repository.SearchPage(ctx, rowSet, filter, "")
+	if err != nil || next == "" {
+		t.Fatalf("expected a first page with a token, got %q %v", next, err)
+	}
+	if len(eventSet.Events["front"]) != 20 {
+		t.Fatalf("expected 20 events, got %d", len(eventSet.Events["front"]))
+	}
+	// the second page ends with the last row so no token is returned
+	eventSet, next, err = repository.SearchPage(ctx, rowSet, filter, next)
+	if err != nil || next != "" {
+		t.Fatalf("expected a last page without token, got %q %v", next, err)
+	}
+	if len(eventSet.Events["front"]) != 20 {
+		t.Fatalf("expected 20 events, got %d", len(eventSet.Events["front"]))
+	}
+}
+
+func TestRepository_SearchPageInvalidToken(t *testing.T) {
+	repository := &Repository{
+		adapter: mockAdapter{},
+		mapper:  getMockMapper(t),
+		maxRows: defaultMaxRows,
+	}
+	_, _, err := repository.SearchPage(context.Background(), bigtable.RowRange{}, bigtable.PassAllFilter(), "not a token")
+	if err == nil {
+		t.Fatal("expected an error for an invalid token")
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+/*
+ReadMany reads several rows from the repository at once and maps them to a single data.Set.
+
+The rows are read concurrently, with at most as many requests in flight as configured with NewConcurrencyOption.
+A failure on one row doesn't prevent the other ones from being returned: the errors are returned in a map indexed by row key,
+which is empty when all the rows have been read successfully. The rows that don't exist are reported with ErrRowNotFound.
+*/
+func (r *Repository) ReadMany(ctx context.Context, keys []string, opts ...CallOption) (*data.Set, map[string]error) {
+	o := newCallOptions(opts)
+	filter := o.filter(r.mapper)
+	workers := r.concurrency
+	if workers <= 0 {
+		workers = defaultConcurrency
+	}
+	jobs := make(chan string)
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		sets = make([]*data.Set, 0, len(keys))
+		errs = make(map[string]error)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				eventSet, err := r.readRow(ctx, key, o, filter)
+				mu.Lock()
+				if err != nil {
+					errs[key] = err
+				} else {
+					sets = append(sets, eventSet)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+	return mergeSets(sets), errs
+}
+
+// readRow reads a single row, failing fast if the context is already done.
+func (r *Repository) readRow(ctx context.Context, key string, o *callOptions, filter bigtable.Filter) (*data.Set, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.read(ctx, "ReadMany", key, o, filter)
+}
+
+// mergeSets gathers the events and the columns of several data.Set into a single one.
+func mergeSets(sets []*data.Set) *data.Set {
+	set := &data.Set{
+		Events:  make(map[string][]*data.Event),
+		Columns: make([]string, 0),
+	}
+	for _, s := range sets {
+		for family, events := range s.Events {
+			set.Events[family] = append(set.Events[family], events...)
+		}
+		set.Columns = merge(set.Columns, s.Columns)
+	}
+	return set
+}
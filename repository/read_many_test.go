@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/bigtable"
+)
+
+var errBrokenRow = errors.New("broken row")
+
+// brokenRowAdapter fails to read the row named "broken".
+type brokenRowAdapter struct {
+	mockAdapter
+}
+
+func (a brokenRowAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	if row == "broken" {
+		return nil, errBrokenRow
+	}
+	return a.mockAdapter.ReadRow(ctx, row, opts...)
+}
+
+func TestRepository_ReadMany(t *testing.T) {
+	ctx := context.Background()
+	repository := &Repository{
+		adapter:     brokenRowAdapter{},
+		mapper:      getMockMapper(t),
+		concurrency: 2,
+	}
+	eventSet, errs := repository.ReadMany(ctx, []string{"contact-1", "broken", "contact-2", "contact-3", "contact-1"})
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+	if errs["broken"] != errBrokenRow {
+		t.Fatalf("expected errBrokenRow, got %v", errs["broken"])
+	}
+	if len(eventSet.Events["front"]) != 9 {
+		t.Fatalf("expected 9 events, got %d", len(eventSet.Events["front"]))
+	}
+	keys := make(map[string]bool)
+	for _, event := range eventSet.Events["front"] {
+		keys[event.RowKey] = true
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(keys))
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, errs = repository.ReadMany(cancelCtx, []string{"contact-1", "contact-2"})
+	if len(errs) != 2 || errs["contact-1"] != context.Canceled {
+		t.Fatalf("expected the rows to fail with context.Canceled, got %v", errs)
+	}
+}
+
+func TestRepository_ReadManyEmulator(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repository := NewRepository(client.Open(table), getMockMapper(t))
+	eventSet, errs := repository.ReadMany(ctx, []string{"contact-1", "contact-2", "contact-3"}, NewFamilyOption("front"))
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(eventSet.Events["front"]) != 300 {
+		t.Fatalf("expected 300 events, got %d", len(eventSet.Events["front"]))
+	}
+}
@@ -0,0 +1,549 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	"github.com/sendinblue/bigtable-access-layer/internal/inspect"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// cassetteVersion is the version of the format of the cassettes written by the RecordingAdapter.
+const cassetteVersion = 2
+
+// ErrUnexpectedCall is returned by the ReplayAdapter for a call that isn't in its cassette.
+var ErrUnexpectedCall = errors.New("unexpected call")
+
+/*
+A cassette is a NDJSON file: its first line is a header holding the version of the format, and each following line is
+an interaction, the request of a call to the adapter along with its response.
+
+The opaque values of the Big Table client are serialized as the deterministic protocol buffers the client would send,
+so that two identical requests give the same values: the row set, the filter and the limit of rows of a read are held
+by a ReadRowsRequest, the condition of CheckAndMutate by a RowFilter and the mutations by MutateRowsRequest entries.
+*/
+type cassetteHeader struct {
+	Version int `json:"version"`
+}
+
+type cassetteRequest struct {
+	Operation string   `json:"operation"`
+	RowKeys   []string `json:"row_keys,omitempty"`
+	Read      []byte   `json:"read,omitempty"`
+	Filter    []byte   `json:"filter,omitempty"`
+	Mutations [][]byte `json:"mutations,omitempty"`
+}
+
+type cassetteResponse struct {
+	Rows    []cassetteRow    `json:"rows,omitempty"`
+	Errors  []*cassetteError `json:"errors,omitempty"`
+	Matched bool             `json:"matched,omitempty"`
+	Error   *cassetteError   `json:"error,omitempty"`
+}
+
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRow struct {
+	Key   string         `json:"key"`
+	Cells []cassetteCell `json:"cells"`
+}
+
+type cassetteCell struct {
+	Column    string   `json:"column"`
+	Timestamp int64    `json:"timestamp"`
+	Value     []byte   `json:"value"`
+	Labels    []string `json:"labels,omitempty"`
+}
+
+type cassetteError struct {
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message"`
+}
+
+// RecordingAdapter is an Adapter writing the calls of the adapter it wraps, with their responses, to a cassette that
+// can be replayed by a ReplayAdapter.
+type RecordingAdapter struct {
+	adapter Adapter
+	mu      sync.Mutex
+	encoder *json.Encoder
+	started bool
+	err     error
+}
+
+func NewRecordingAdapter(adapter Adapter, w io.Writer) *RecordingAdapter {
+	return &RecordingAdapter{
+		adapter: adapter,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+type RecordingAdapterOption struct {
+	writer io.Writer
+}
+
+func NewRecordingAdapterOption(w io.Writer) *RecordingAdapterOption {
+	return &RecordingAdapterOption{
+		writer: w,
+	}
+}
+
+func (opt *RecordingAdapterOption) apply(repo *Repository) {
+	repo.adapter = NewRecordingAdapter(repo.adapter, opt.writer)
+}
+
+// Err returns the first error that occurred while writing the cassette.
+func (a *RecordingAdapter) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+func (a *RecordingAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	request, err := readRowRequest(row, opts)
+	if err != nil {
+		return nil, err
+	}
+	btRow, err := a.adapter.ReadRow(ctx, row, opts...)
+	response := cassetteResponse{Error: toCassetteError(err)}
+	if btRow != nil {
+		response.Rows = []cassetteRow{toCassetteRow(row, btRow)}
+	}
+	a.record(request, response)
+	return btRow, err
+}
+
+// ReadRows records the rows delivered to the callback.
+func (a *RecordingAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	request, err := readRowsRequest(arg, opts)
+	if err != nil {
+		return err
+	}
+	var rows []cassetteRow
+	err = a.adapter.ReadRows(ctx, arg, func(row bigtable.Row) bool {
+		rows = append(rows, toCassetteRow(row.Key(), row))
+		return f(row)
+	}, opts...)
+	a.record(request, cassetteResponse{Rows: rows, Error: toCassetteError(err)})
+	return err
+}
+
+func (a *RecordingAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) (errs []error, err error) {
+	request, err := applyBulkRequest(rowKeys, muts)
+	if err != nil {
+		return nil, err
+	}
+	errs, err = a.adapter.ApplyBulk(ctx, rowKeys, muts, opts...)
+	response := cassetteResponse{Error: toCassetteError(err)}
+	for _, e := range errs {
+		response.Errors = append(response.Errors, toCassetteError(e))
+	}
+	a.record(request, response)
+	return errs, err
+}
+
+func (a *RecordingAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	request, err := checkAndMutateRequest(row, cond, mtrue, mfalse)
+	if err != nil {
+		return false, err
+	}
+	matched, err = a.adapter.CheckAndMutate(ctx, row, cond, mtrue, mfalse)
+	a.record(request, cassetteResponse{Matched: matched, Error: toCassetteError(err)})
+	return matched, err
+}
+
+func (a *RecordingAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	request, err := readModifyWriteRequest(row, m)
+	if err != nil {
+		return nil, err
+	}
+	btRow, err := a.adapter.ApplyReadModifyWrite(ctx, row, m)
+	response := cassetteResponse{Error: toCassetteError(err)}
+	if btRow != nil {
+		response.Rows = []cassetteRow{toCassetteRow(row, btRow)}
+	}
+	a.record(request, response)
+	return btRow, err
+}
+
+// record writes an interaction to the cassette, preceded by the header for the first one.
+func (a *RecordingAdapter) record(request cassetteRequest, response cassetteResponse) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return
+	}
+	if !a.started {
+		a.started = true
+		if a.err = a.encoder.Encode(cassetteHeader{Version: cassetteVersion}); a.err != nil {
+			return
+		}
+	}
+	a.err = a.encoder.Encode(cassetteInteraction{Request: request, Response: response})
+}
+
+/*
+ReplayAdapter is an Adapter serving the responses recorded in a cassette by a RecordingAdapter, without calling Big Table.
+
+A call is matched with a recorded interaction having the same request, the identical requests being served in the order
+they were recorded. A call that doesn't match any remaining interaction fails with ErrUnexpectedCall, and Verify
+reports those calls as well as the interactions that have not been replayed.
+*/
+type ReplayAdapter struct {
+	mu           sync.Mutex
+	interactions map[string][]cassetteResponse
+	unexpected   []string
+}
+
+// NewReplayAdapter loads a cassette written by a RecordingAdapter.
+func NewReplayAdapter(r io.Reader) (*ReplayAdapter, error) {
+	decoder := json.NewDecoder(r)
+	a := &ReplayAdapter{interactions: make(map[string][]cassetteResponse)}
+	var header cassetteHeader
+	if err := decoder.Decode(&header); err != nil {
+		// the RecordingAdapter doesn't write anything when there is no call
+		if err == io.EOF {
+			return a, nil
+		}
+		return nil, errors.Wrap(err, "invalid cassette header")
+	}
+	if header.Version != cassetteVersion {
+		return nil, errors.Errorf("unsupported cassette version %d, expected %d", header.Version, cassetteVersion)
+	}
+	for line := 2; ; line++ {
+		var interaction cassetteInteraction
+		if err := decoder.Decode(&interaction); err != nil {
+			if err == io.EOF {
+				return a, nil
+			}
+			return nil, errors.Wrapf(err, "invalid interaction on line %d", line)
+		}
+		key := interaction.Request.key()
+		a.interactions[key] = append(a.interactions[key], interaction.Response)
+	}
+}
+
+type ReplayAdapterOption struct {
+	adapter *ReplayAdapter
+}
+
+// NewReplayAdapterOption makes the repository use the ReplayAdapter instead of the table.
+func NewReplayAdapterOption(adapter *ReplayAdapter) *ReplayAdapterOption {
+	return &ReplayAdapterOption{
+		adapter: adapter,
+	}
+}
+
+func (opt *ReplayAdapterOption) apply(repo *Repository) {
+	repo.adapter = opt.adapter
+}
+
+// Verify returns an error if calls didn't match the cassette or if recorded interactions have not been replayed.
+func (a *ReplayAdapter) Verify() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var problems []string
+	for _, call := range a.unexpected {
+		problems = append(problems, "unexpected call "+call)
+	}
+	var unused []string
+	for key, responses := range a.interactions {
+		for range responses {
+			unused = append(unused, "interaction not replayed "+key)
+		}
+	}
+	sort.Strings(unused)
+	problems = append(problems, unused...)
+	if len(problems) > 0 {
+		return errors.Errorf("the cassette doesn't match the calls:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func (a *ReplayAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	request, err := readRowRequest(row, opts)
+	if err != nil {
+		return nil, err
+	}
+	response, err := a.replay(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var btRow bigtable.Row
+	if len(response.Rows) > 0 {
+		btRow = fromCassetteRow(response.Rows[0])
+	}
+	return btRow, fromCassetteError(response.Error)
+}
+
+func (a *ReplayAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	request, err := readRowsRequest(arg, opts)
+	if err != nil {
+		return err
+	}
+	response, err := a.replay(ctx, request)
+	if err != nil {
+		return err
+	}
+	for _, row := range response.Rows {
+		if !f(fromCassetteRow(row)) {
+			return nil
+		}
+	}
+	return fromCassetteError(response.Error)
+}
+
+func (a *ReplayAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, _ ...bigtable.ApplyOption) (errs []error, err error) {
+	request, err := applyBulkRequest(rowKeys, muts)
+	if err != nil {
+		return nil, err
+	}
+	response, err := a.replay(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range response.Errors {
+		errs = append(errs, fromCassetteError(e))
+	}
+	return errs, fromCassetteError(response.Error)
+}
+
+func (a *ReplayAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	request, err := checkAndMutateRequest(row, cond, mtrue, mfalse)
+	if err != nil {
+		return false, err
+	}
+	response, err := a.replay(ctx, request)
+	if err != nil {
+		return false, err
+	}
+	return response.Matched, fromCassetteError(response.Error)
+}
+
+func (a *ReplayAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	request, err := readModifyWriteRequest(row, m)
+	if err != nil {
+		return nil, err
+	}
+	response, err := a.replay(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var btRow bigtable.Row
+	if len(response.Rows) > 0 {
+		btRow = fromCassetteRow(response.Rows[0])
+	}
+	return btRow, fromCassetteError(response.Error)
+}
+
+// replay returns the next recorded response of the request.
+func (a *ReplayAdapter) replay(ctx context.Context, request cassetteRequest) (cassetteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return cassetteResponse{}, err
+	}
+	key := request.key()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	responses := a.interactions[key]
+	if len(responses) == 0 {
+		a.unexpected = append(a.unexpected, key)
+		return cassetteResponse{}, errors.Wrap(ErrUnexpectedCall, key)
+	}
+	if len(responses) == 1 {
+		delete(a.interactions, key)
+	} else {
+		a.interactions[key] = responses[1:]
+	}
+	return responses[0], nil
+}
+
+// key identifies the request in the cassette.
+func (r cassetteRequest) key() string {
+	// the request only holds strings and bytes, so it can always be encoded
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func readRowRequest(row string, opts []bigtable.ReadOption) (cassetteRequest, error) {
+	b, err := marshalRead(bigtable.RowList{row}, opts)
+	if err != nil {
+		return cassetteRequest{}, err
+	}
+	return cassetteRequest{Operation: "ReadRow", RowKeys: []string{row}, Read: b}, nil
+}
+
+func readRowsRequest(arg bigtable.RowSet, opts []bigtable.ReadOption) (cassetteRequest, error) {
+	b, err := marshalRead(arg, opts)
+	if err != nil {
+		return cassetteRequest{}, err
+	}
+	return cassetteRequest{Operation: "ReadRows", Read: b}, nil
+}
+
+func applyBulkRequest(rowKeys []string, muts []*bigtable.Mutation) (cassetteRequest, error) {
+	request := cassetteRequest{Operation: "ApplyBulk", RowKeys: rowKeys}
+	for i, mut := range muts {
+		b, err := marshalMutation(rowKeys[i], mut)
+		if err != nil {
+			return cassetteRequest{}, err
+		}
+		request.Mutations = append(request.Mutations, b)
+	}
+	return request, nil
+}
+
+func checkAndMutateRequest(row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (cassetteRequest, error) {
+	bTrue, err := marshalMutation(row, mtrue)
+	if err != nil {
+		return cassetteRequest{}, err
+	}
+	bFalse, err := marshalMutation(row, mfalse)
+	if err != nil {
+		return cassetteRequest{}, err
+	}
+	filter, err := inspect.FilterProto(cond)
+	if err != nil {
+		return cassetteRequest{}, err
+	}
+	bFilter, err := proto.MarshalOptions{Deterministic: true}.Marshal(filter)
+	if err != nil {
+		return cassetteRequest{}, errors.Wrap(err, "marshal filter")
+	}
+	return cassetteRequest{
+		Operation: "CheckAndMutate",
+		RowKeys:   []string{row},
+		Filter:    bFilter,
+		Mutations: [][]byte{bTrue, bFalse},
+	}, nil
+}
+
+func readModifyWriteRequest(row string, m *bigtable.ReadModifyWrite) (cassetteRequest, error) {
+	rules, err := inspect.ReadModifyWriteRules(m)
+	if err != nil {
+		return cassetteRequest{}, err
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(&btpb.ReadModifyWriteRowRequest{
+		RowKey: []byte(row),
+		Rules:  rules,
+	})
+	if err != nil {
+		return cassetteRequest{}, errors.Wrap(err, "marshal read modify write")
+	}
+	return cassetteRequest{Operation: "ApplyReadModifyWrite", RowKeys: []string{row}, Mutations: [][]byte{b}}, nil
+}
+
+// marshalRead serializes the row set and the read options of a read as a deterministic ReadRowsRequest.
+func marshalRead(rowSet bigtable.RowSet, opts []bigtable.ReadOption) ([]byte, error) {
+	rows, err := rowSetProto(rowSet)
+	if err != nil {
+		return nil, err
+	}
+	filter, limit, err := inspect.ReadOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(&btpb.ReadRowsRequest{Rows: rows, Filter: filter, RowsLimit: limit})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal read")
+	}
+	return b, nil
+}
+
+// marshalMutation serializes the operations of a mutation as a deterministic protocol buffer. The operations are
+// sorted, as the mapper builds them from maps in no particular order.
+func marshalMutation(row string, mut *bigtable.Mutation) ([]byte, error) {
+	options := proto.MarshalOptions{Deterministic: true}
+	mutOps, err := inspect.MutationOps(mut)
+	if err != nil {
+		return nil, err
+	}
+	ops := append([]*btpb.Mutation(nil), mutOps...)
+	serialized := make(map[*btpb.Mutation]string, len(ops))
+	for _, op := range ops {
+		b, _ := options.Marshal(op)
+		serialized[op] = string(b)
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return serialized[ops[i]] < serialized[ops[j]] })
+	b, err := options.Marshal(&btpb.MutateRowsRequest_Entry{RowKey: []byte(row), Mutations: ops})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal mutation")
+	}
+	return b, nil
+}
+
+func toCassetteRow(key string, row bigtable.Row) cassetteRow {
+	result := cassetteRow{Key: key}
+	for _, family := range sortedRowFamilies(row) {
+		for _, item := range row[family] {
+			result.Cells = append(result.Cells, cassetteCell{
+				Column:    item.Column,
+				Timestamp: int64(item.Timestamp),
+				Value:     item.Value,
+				Labels:    item.Labels,
+			})
+		}
+	}
+	return result
+}
+
+func fromCassetteRow(row cassetteRow) bigtable.Row {
+	result := make(bigtable.Row)
+	for _, c := range row.Cells {
+		family := c.Column
+		if i := strings.Index(c.Column, ":"); i >= 0 {
+			family = c.Column[:i]
+		}
+		result[family] = append(result[family], bigtable.ReadItem{
+			Row:       row.Key,
+			Column:    c.Column,
+			Timestamp: bigtable.Timestamp(c.Timestamp),
+			Value:     c.Value,
+			Labels:    c.Labels,
+		})
+	}
+	return result
+}
+
+func sortedRowFamilies(row bigtable.Row) []string {
+	families := make([]string, 0, len(row))
+	for family := range row {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	return families
+}
+
+func toCassetteError(err error) *cassetteError {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	if s, ok := status.FromError(err); ok {
+		message = s.Message()
+	}
+	return &cassetteError{Code: errorCode(err), Message: message}
+}
+
+// fromCassetteError restores the error of a call, the errors of the context being restored as such.
+func fromCassetteError(e *cassetteError) error {
+	switch {
+	case e == nil:
+		return nil
+	case e.Code == codes.Canceled && e.Message == context.Canceled.Error():
+		return context.Canceled
+	case e.Code == codes.DeadlineExceeded && e.Message == context.DeadlineExceeded.Error():
+		return context.DeadlineExceeded
+	}
+	return status.Error(e.Code, e.Message)
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecordingAdapter_Replay(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	var cassette bytes.Buffer
+	recorder := NewRepository(client.Open(table), getMockMapper(t), NewRecordingAdapterOption(&cassette))
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"))
+
+	expectedRead, err := recorder.Read(ctx, "contact-3")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	expectedSearch, err := recorder.Search(ctx, bigtable.PrefixRange("contact-"), filter)
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	expectedWrite, err := recorder.Write(ctx, expectedRead)
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err = recorder.adapter.(*RecordingAdapter).Err(); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	if !strings.HasPrefix(cassette.String(), "{\"version\":2}\n") {
+		t.Fatalf("expected the cassette to start with its version, got %.50s", cassette.String())
+	}
+
+	replay, err := NewReplayAdapter(&cassette)
+	if err != nil {
+		t.Fatalf("failed to load the cassette: %v", err)
+	}
+	repo := NewRepositoryWithAdapter(replay, getMockMapper(t))
+	read, err := repo.Read(ctx, "contact-3")
+	if err != nil {
+		t.Fatalf("failed to replay the read: %v", err)
+	}
+	if !reflect.DeepEqual(eventsByKey(expectedRead), eventsByKey(read)) {
+		t.Fatal("the replayed read differs from the recorded one")
+	}
+	search, err := repo.Search(ctx, bigtable.PrefixRange("contact-"), filter)
+	if err != nil {
+		t.Fatalf("failed to replay the search: %v", err)
+	}
+	if !reflect.DeepEqual(eventsByKey(expectedSearch), eventsByKey(search)) {
+		t.Fatal("the replayed search differs from the recorded one")
+	}
+	write, err := repo.Write(ctx, expectedRead)
+	if err != nil {
+		t.Fatalf("failed to replay the write: %v", err)
+	}
+	if write.HasFailures() != expectedWrite.HasFailures() {
+		t.Fatal("the replayed write differs from the recorded one")
+	}
+	if err = replay.Verify(); err != nil {
+		t.Fatalf("expected the whole cassette to be replayed: %v", err)
+	}
+
+	if _, err = repo.Read(ctx, "contact-3"); !errors.Is(err, ErrUnexpectedCall) {
+		t.Fatalf("expected an unexpected call, got %v", err)
+	}
+	if err = replay.Verify(); err == nil || !strings.Contains(err.Error(), "unexpected call") {
+		t.Fatalf("expected Verify to report the unexpected call, got %v", err)
+	}
+}
+
+func TestRecordingAdapter_Errors(t *testing.T) {
+	ctx := context.Background()
+	var cassette bytes.Buffer
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	recorder := NewRecordingAdapter(&faultyAdapter{
+		readRowErrs: []error{unavailable, context.Canceled},
+		bulkErrs: func(_ int, rowKeys []string) []error {
+			return []error{nil, status.Error(codes.InvalidArgument, "invalid")}
+		},
+	}, &cassette)
+	_, _ = recorder.ReadRow(ctx, "contact-1")
+	_, _ = recorder.ReadRow(ctx, "contact-1")
+	muts := []*bigtable.Mutation{bigtable.NewMutation(), bigtable.NewMutation()}
+	muts[0].Set("front", "e", 1000, []byte("11"))
+	_, _ = recorder.ApplyBulk(ctx, []string{"ok", "invalid"}, muts)
+
+	replay, err := NewReplayAdapter(&cassette)
+	if err != nil {
+		t.Fatalf("failed to load the cassette: %v", err)
+	}
+	if _, err = replay.ReadRow(ctx, "contact-1"); status.Code(err) != codes.Unavailable || status.Convert(err).Message() != "unavailable" {
+		t.Fatalf("expected the recorded error, got %v", err)
+	}
+	if _, err = replay.ReadRow(ctx, "contact-1"); err != context.Canceled {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	errs, err := replay.ApplyBulk(ctx, []string{"ok", "invalid"}, muts)
+	if err != nil || len(errs) != 2 || errs[0] != nil || status.Code(errs[1]) != codes.InvalidArgument {
+		t.Fatalf("expected the recorded entry errors, got %v %v", errs, err)
+	}
+}
+
+func TestReadRowsRequest(t *testing.T) {
+	key := func(rowSet bigtable.RowSet, opts ...bigtable.ReadOption) string {
+		request, err := readRowsRequest(rowSet, opts)
+		if err != nil {
+			t.Fatalf("failed to build the request: %v", err)
+		}
+		return request.key()
+	}
+	filter := func(n int) bigtable.ReadOption {
+		return bigtable.RowFilter(bigtable.ChainFilters(bigtable.FamilyFilter("front"), bigtable.LatestNFilter(n)))
+	}
+	if key(bigtable.PrefixRange("contact-"), filter(1)) != key(bigtable.PrefixRange("contact-"), filter(1)) {
+		t.Fatal("expected identical reads to get the same key")
+	}
+	// the key is the one of the request sent to Big Table, whatever the way the row set is built
+	if key(bigtable.PrefixRange("contact-"), filter(1)) != key(bigtable.NewRange("contact-", "contact."), filter(1)) {
+		t.Fatal("expected the same ranges to get the same key")
+	}
+	if key(bigtable.PrefixRange("contact-"), filter(1)) == key(bigtable.PrefixRange("contact-"), filter(2)) {
+		t.Fatal("expected different filters to get different keys")
+	}
+	if key(bigtable.PrefixRange("contact-"), filter(1)) == key(bigtable.PrefixRange("contact-"), filter(1), bigtable.LimitRows(10)) {
+		t.Fatal("expected different limits to get different keys")
+	}
+}
+
+func TestNewReplayAdapter_Version(t *testing.T) {
+	if _, err := NewReplayAdapter(strings.NewReader("{\"version\":42}\n")); err == nil {
+		t.Fatal("expected an error for an unsupported version")
+	}
+	replay, err := NewReplayAdapter(strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("expected an empty cassette to be valid, got %v", err)
+	}
+	if err = replay.Verify(); err != nil {
+		t.Fatalf("expected nothing to replay, got %v", err)
+	}
+}
+
+// eventsByKey indexes the events of a set by family, row key and date, as the mapper returns them in no particular order.
+func eventsByKey(set *data.Set) map[string]map[string]string {
+	result := make(map[string]map[string]string)
+	for family, events := range set.Events {
+		for _, event := range events {
+			for column, value := range event.Cells {
+				key := family + "|" + event.RowKey + "|" + event.Date.String()
+				if result[key] == nil {
+					result[key] = make(map[string]string)
+				}
+				result[key][column] = value
+			}
+		}
+	}
+	return result
+}
@@ -3,18 +3,32 @@ package repository
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
 	"github.com/sendinblue/bigtable-access-layer/data"
 	"github.com/sendinblue/bigtable-access-layer/mapping"
 )
 
-const defaultMaxRows = 100
+const (
+	defaultMaxRows     = 100
+	defaultConcurrency = 10
+)
+
+// ErrRowNotFound is returned by the read methods of the Repository when the row doesn't exist.
+var ErrRowNotFound = errors.New("row not found")
 
 type Repository struct {
-	adapter Adapter
-	mapper  *mapping.Mapper
-	maxRows int
+	adapter        Adapter
+	mapper         *mapping.Mapper
+	maxRows        int
+	concurrency    int
+	maxBulkEntries int
+	maxBulkBytes   int
+	timeouts       Timeouts
+	hooks          []Hook
 }
 
 // NewRepository creates a new Repository for the given table.
@@ -22,10 +36,19 @@ func NewRepository(table *bigtable.Table, mapper *mapping.Mapper, opts ...Option
 	adapter := &bigTableAdapter{
 		table: table,
 	}
+	return NewRepositoryWithAdapter(adapter, mapper, opts...)
+}
+
+// NewRepositoryWithAdapter creates a new Repository reading and writing through the given Adapter, such as the
+// in-memory one of the memory package.
+func NewRepositoryWithAdapter(adapter Adapter, mapper *mapping.Mapper, opts ...Option) *Repository {
 	repo := &Repository{
-		adapter: adapter,
-		mapper:  mapper,
-		maxRows: defaultMaxRows,
+		adapter:        adapter,
+		mapper:         mapper,
+		maxRows:        defaultMaxRows,
+		concurrency:    defaultConcurrency,
+		maxBulkEntries: defaultMaxBulkEntries,
+		maxBulkBytes:   defaultMaxBulkBytes,
 	}
 	for _, opt := range opts {
 		opt.apply(repo)
@@ -37,22 +60,44 @@ type Option interface {
 	apply(r *Repository)
 }
 
+// MaxRowsOption sets the maximum number of rows returned by Search and the page size of SearchPage.
+// Search doesn't limit the number of rows when it is zero or less.
 type MaxRowsOption struct {
 	maxRows int
 }
 
+func NewMaxRowsOption(maxRows int) MaxRowsOption {
+	return MaxRowsOption{maxRows: maxRows}
+}
+
 func (o MaxRowsOption) apply(r *Repository) {
 	r.maxRows = o.maxRows
 }
 
+// ConcurrencyOption sets the maximum number of concurrent requests sent to Big Table by ReadMany.
+type ConcurrencyOption struct {
+	concurrency int
+}
+
+func NewConcurrencyOption(concurrency int) ConcurrencyOption {
+	return ConcurrencyOption{concurrency: concurrency}
+}
+
+func (o ConcurrencyOption) apply(r *Repository) {
+	r.concurrency = o.concurrency
+}
+
 /*
 Read a row from the repository and map it to a data.Set
 
 This method takes a row key as an argument, uses its internal adapter to read the row from Big Table,
 parses all cells contained in the row to turn it into a map of data.Event and finally returns the data.Set that contains all the events.
+The options allow to restrict the read, for instance to some columns only (see NewColumnsOption).
+It returns ErrRowNotFound when the row doesn't exist, like all the other read methods.
 */
-func (r *Repository) Read(ctx context.Context, key string) (*data.Set, error) {
-	return r.read(ctx, key)
+func (r *Repository) Read(ctx context.Context, key string, opts ...CallOption) (*data.Set, error) {
+	o := newCallOptions(opts)
+	return r.read(ctx, "Read", key, o, o.filter(r.mapper))
 }
 
 /*
@@ -62,18 +107,35 @@ This method takes a row key and the column family as an argument, uses its inter
 parses all cells contained in the row to turn it into a map of data.Event and finally returns the data.Set that contains all the events.
 
 Be careful, this method will perform an exact match on the column family name.
+The options allow to further restrict the read, for instance to some columns only.
 */
-func (r *Repository) ReadFamily(ctx context.Context, key string, family string) (*data.Set, error) {
-	familyFilter := bigtable.RowFilter(bigtable.FamilyFilter(family))
-	return r.read(ctx, key, familyFilter)
+func (r *Repository) ReadFamily(ctx context.Context, key string, family string, opts ...CallOption) (*data.Set, error) {
+	o := newCallOptions(opts)
+	return r.read(ctx, "ReadFamily", key, o, o.filter(r.mapper, bigtable.FamilyFilter(family)))
 }
 
 // ReadLast reads a row from the repository while returning only the latest cell values after
 // mapping it to a data.Set. This method takes a row key as an argument, uses its internal adapter
 // to read the row from Big Table, parses only the latest cells contained in the row to turn it into
 // a map of data.Event and finally returns the data.Set that contains all the events.
-func (r *Repository) ReadLast(ctx context.Context, key string) (*data.Set, error) {
-	return r.read(ctx, key, bigtable.RowFilter(bigtable.LatestNFilter(1)))
+// The options allow to further restrict the read, for instance to some columns only.
+func (r *Repository) ReadLast(ctx context.Context, key string, opts ...CallOption) (*data.Set, error) {
+	o := newCallOptions(opts)
+	return r.read(ctx, "ReadLast", key, o, o.filter(r.mapper, bigtable.LatestNFilter(1)))
+}
+
+// ReadBetween reads a row from the repository keeping only the events that happened between from (inclusive) and to
+// (exclusive) and maps it to a data.Set. A zero time means no bound. The options allow to further restrict the read,
+// for instance to a single column family.
+func (r *Repository) ReadBetween(ctx context.Context, key string, from, to time.Time, opts ...CallOption) (*data.Set, error) {
+	o := newCallOptions(opts)
+	return r.read(ctx, "ReadBetween", key, o, o.filter(r.mapper, bigtable.TimestampRangeFilter(from, to)))
+}
+
+// ReadSince reads a row from the repository keeping only the events that happened since the given time and maps it to a data.Set.
+// The options allow to further restrict the read, for instance to a single column family.
+func (r *Repository) ReadSince(ctx context.Context, key string, since time.Time, opts ...CallOption) (*data.Set, error) {
+	return r.ReadBetween(ctx, key, since, time.Time{}, opts...)
 }
 
 // ReadRow reads a row from the repository while returning the cell values after
@@ -81,19 +143,107 @@ func (r *Repository) ReadLast(ctx context.Context, key string) (*data.Set, error
 // to read the row from Big Table, parses only the cells contained in the row to turn it into
 // a map of data.Event and finally returns the data.Set that contains all the events.
 func (r *Repository) ReadRow(ctx context.Context, key string, opts ...bigtable.ReadOption) (*data.Set, error) {
-	row, err := r.adapter.ReadRow(ctx, key, opts...)
+	return r.read(ctx, "ReadRow", key, nil, nil, opts...)
+}
+
+// Exists reports whether the row exists in the repository, reading at most one of its cells, without its value.
+func (r *Repository) Exists(ctx context.Context, key string, opts ...CallOption) (exists bool, err error) {
+	ctx, done := r.startOperation(ctx, operationRead, "Exists", key, newCallOptions(opts))
+	defer done(&err)
+	return r.exists(ctx, key)
+}
+
+func (r *Repository) exists(ctx context.Context, key string) (bool, error) {
+	row, err := r.adapter.ReadRow(ctx, key, bigtable.RowFilter(firstCellFilter()))
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	return buildEventSet([]bigtable.Row{row}, r.mapper), nil
+	return len(row) > 0, nil
 }
 
-func (r *Repository) read(ctx context.Context, key string, opts ...bigtable.ReadOption) (*data.Set, error) {
+/*
+read reads a row with the filter, if any, and the read options and maps it to a data.Set. It returns ErrRowNotFound
+when the row doesn't exist.
+
+Big Table returns an empty row for a missing key, so an empty row read with a filter may as well be an existing row in
+which no cell matches the filter. The filter is therefore read along with the first cell of the row (see
+existenceFilter), which tells them apart in the same request.
+*/
+func (r *Repository) read(ctx context.Context, operation, key string, o *callOptions, filter bigtable.Filter, opts ...bigtable.ReadOption) (eventSet *data.Set, err error) {
+	ctx, done := r.startOperation(ctx, operationRead, operation, key, o)
+	defer done(&err)
+	if err = r.beforeRead(ctx, operation, key); err != nil {
+		return nil, err
+	}
+	if filter != nil {
+		opts = append(opts[:len(opts):len(opts)], bigtable.RowFilter(existenceFilter(filter)))
+	}
 	row, err := r.adapter.ReadRow(ctx, key, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return buildEventSet([]bigtable.Row{row}, r.mapper), nil
+	if filter != nil {
+		var exists bool
+		if row, exists = splitExistenceRow(row); !exists {
+			return nil, ErrRowNotFound
+		}
+	} else if err = r.checkFound(ctx, key, row, opts); err != nil {
+		return nil, err
+	}
+	eventSet = buildEventSet([]bigtable.Row{row}, r.mapper)
+	if err = r.afterRead(ctx, eventSet); err != nil {
+		return nil, err
+	}
+	return eventSet, nil
+}
+
+// checkFound returns ErrRowNotFound when the row read with the given options is empty because it doesn't exist.
+// The options given to ReadRow are opaque and can't be combined with existenceFilter, so when there are some, Exists is
+// called to tell a missing row from an existing row in which no cell matches them.
+func (r *Repository) checkFound(ctx context.Context, key string, row bigtable.Row, opts []bigtable.ReadOption) error {
+	if len(row) > 0 {
+		return nil
+	}
+	if len(opts) > 0 {
+		exists, err := r.exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+	}
+	return ErrRowNotFound
+}
+
+// existsLabel is the label applied by existenceFilter to the first cell of the row.
+const existsLabel = "bal-exists"
+
+// firstCellFilter keeps the first cell of a row, without its value.
+func firstCellFilter() bigtable.Filter {
+	return bigtable.ChainFilters(bigtable.CellsPerRowLimitFilter(1), bigtable.StripValueFilter())
+}
+
+// existenceFilter interleaves the filter of a read with the first cell of the row, labelled with existsLabel, so that
+// an existing row is never returned empty.
+func existenceFilter(filter bigtable.Filter) bigtable.Filter {
+	return bigtable.InterleaveFilters(filter, bigtable.ChainFilters(firstCellFilter(), bigtable.LabelFilter(existsLabel)))
+}
+
+// splitExistenceRow removes from a row read with existenceFilter the cell labelled with existsLabel, reporting whether
+// the row exists, that is whether it had any cell.
+func splitExistenceRow(row bigtable.Row) (bigtable.Row, bool) {
+	exists := false
+	result := make(bigtable.Row, len(row))
+	for family, items := range row {
+		for _, item := range items {
+			exists = true
+			if !hasLabel(item, existsLabel) {
+				result[family] = append(result[family], item)
+			}
+		}
+	}
+	return result, exists
 }
 
 func buildEventSet(rows []bigtable.Row, mapper *mapping.Mapper) *data.Set {
@@ -111,61 +261,173 @@ func buildEventSet(rows []bigtable.Row, mapper *mapping.Mapper) *data.Set {
 	return set
 }
 
-// Search for rows in the repository that match the given filter and return the according data.Set
-func (r *Repository) Search(ctx context.Context, rowSet bigtable.RowSet, filter bigtable.Filter) (*data.Set, error) {
-	rows, err := r.search(ctx, rowSet, filter)
+/*
+Search for rows in the repository that match the given filter and return the according data.Set.
+
+The rows are read in a single request: the filter is interleaved with a branch returning the whole row, labelled with
+fullRowLabel, and the events are rebuilt from the cells sharing the timestamps of the cells matched by the filter.
+As the matched cells and the full row are read at once, they are always consistent with each other.
+The filter may apply its own labels, but not fullRowLabel.
+The options allow to restrict the events returned, for instance to some columns only (see NewColumnsOption), without
+changing the rows matched by the filter.
+*/
+func (r *Repository) Search(ctx context.Context, rowSet bigtable.RowSet, filter bigtable.Filter, opts ...CallOption) (eventSet *data.Set, err error) {
+	o := newCallOptions(opts)
+	ctx, done := r.startScan(ctx, "Search", rowSet, o)
+	defer done(&err)
+	if err = r.beforeScan(ctx, "Search", rowSet); err != nil {
+		return nil, err
+	}
+	var readOpts []bigtable.ReadOption
+	if r.maxRows > 0 {
+		readOpts = append(readOpts, bigtable.LimitRows(int64(r.maxRows)))
+	}
+	var result []bigtable.Row
+	err = r.searchRows(ctx, rowSet, filter, o, func(_ string, timestamps []bigtable.Timestamp, fullRow bigtable.Row) bool {
+		result = append(result, filterReadItems(fullRow, timestamps))
+		return r.maxRows <= 0 || len(result) < r.maxRows
+	}, readOpts...)
 	if err != nil {
 		return nil, err
 	}
-	resultMap := mapResult(rows, r.maxRows)
-	result := make([]bigtable.Row, 0, len(resultMap))
-	for key, row := range resultMap {
-		fullRow, err := r.adapter.ReadRow(ctx, key)
-		if err != nil {
-			return nil, err
+	eventSet = buildEventSet(result, r.mapper)
+	if err = r.afterRead(ctx, eventSet); err != nil {
+		return nil, err
+	}
+	return eventSet, nil
+}
+
+// SearchIter streams the rows in the repository that match the given filter and calls f with the data.Set of each
+// row as soon as it is mapped, instead of loading the whole result in memory like Search does. Like Search, it reads
+// the rows in a single request.
+// Returning false from f stops the iteration. The iteration also stops when the context is canceled, in which case
+// the context's error is returned.
+func (r *Repository) SearchIter(ctx context.Context, rowSet bigtable.RowSet, filter bigtable.Filter, f func(*data.Set) bool, opts ...CallOption) (err error) {
+	o := newCallOptions(opts)
+	ctx, done := r.startScan(ctx, "SearchIter", rowSet, o)
+	defer done(&err)
+	if err = r.beforeScan(ctx, "SearchIter", rowSet); err != nil {
+		return err
+	}
+	var iterErr error
+	err = r.searchRows(ctx, rowSet, filter, o, func(_ string, timestamps []bigtable.Timestamp, fullRow bigtable.Row) bool {
+		if iterErr = ctx.Err(); iterErr != nil {
+			return false
+		}
+		eventSet := buildEventSet([]bigtable.Row{filterReadItems(fullRow, timestamps)}, r.mapper)
+		if iterErr = r.afterRead(ctx, eventSet); iterErr != nil {
+			return false
 		}
-		result = append(result, filterReadItems(fullRow, row))
+		return f(eventSet)
+	})
+	if iterErr != nil {
+		return iterErr
 	}
-	return buildEventSet(result, r.mapper), nil
+	if err != nil && ctx.Err() != nil {
+		// the stream reports the cancellation with its own status
+		return ctx.Err()
+	}
+	return err
 }
 
-func (r *Repository) Write(ctx context.Context, eventSet *data.Set) ([]error, error) {
-	allMutations := r.mapper.GetMutations(eventSet)
+// Write writes the events of the data.Set into the repository, calling the write hooks if any (see Hook).
+// The events are sent in as many requests as needed to comply with the bulk limits (see NewBulkLimitsOption).
+// The returned WriteResult lists the rows that could not be written along with their events, while the error
+// reports that at least one of the requests failed as a whole.
+func (r *Repository) Write(ctx context.Context, eventSet *data.Set, opts ...CallOption) (result *WriteResult, err error) {
+	ctx, done := r.startOperation(ctx, operationWrite, "Write", firstRowKey(eventSet), newCallOptions(opts))
+	defer done(&err)
+	if err = r.beforeWrite(ctx, eventSet); err != nil {
+		return nil, err
+	}
+	result, err = r.write(ctx, eventSet, r.mapper.GetMutations)
+	if err != nil {
+		return result, err
+	}
+	return result, r.afterWrite(ctx, result)
+}
+
+// applyBulk applies the mutations of each row and maps the errors back to the events carried by the rows.
+func (r *Repository) applyBulk(ctx context.Context, allMutations map[string]*bigtable.Mutation, events map[string]map[string][]*data.Event) (*WriteResult, error) {
 	rowKeys := make([]string, 0, len(allMutations))
-	mutations := make([]*bigtable.Mutation, 0, len(allMutations))
 	for key := range allMutations {
 		rowKeys = append(rowKeys, key)
+	}
+	sort.Strings(rowKeys)
+	mutations := make([]*bigtable.Mutation, 0, len(allMutations))
+	for _, key := range rowKeys {
 		mutations = append(mutations, allMutations[key])
 	}
-	return r.adapter.ApplyBulk(ctx, rowKeys, mutations)
-}
-
-func (r *Repository) search(ctx context.Context, rowSet bigtable.RowSet, filter bigtable.Filter) ([]bigtable.Row, error) {
-	var rows []bigtable.Row
-	err := r.adapter.ReadRows(ctx, rowSet, func(row bigtable.Row) bool {
-		rows = append(rows, row)
-		return true
-	}, bigtable.RowFilter(filter))
+	errs, err := r.adapter.ApplyBulk(ctx, rowKeys, mutations)
 	if err != nil {
 		return nil, err
 	}
-	return rows, nil
+	result := &WriteResult{}
+	for i, e := range errs {
+		if e != nil {
+			result.Failures = append(result.Failures, &WriteFailure{
+				RowKey: rowKeys[i],
+				Events: events[rowKeys[i]],
+				Err:    e,
+			})
+		}
+	}
+	return result, nil
+}
+
+// fullRowLabel is the label applied by searchFilter to the cells of the full row.
+const fullRowLabel = "bal-full-row"
+
+// searchFilter wraps the filter of a search so that the rows it matches are returned with the matched cells along with
+// all their cells kept by the projection, if any, labelled with fullRowLabel, while the rows it doesn't match are not
+// returned at all.
+func searchFilter(filter bigtable.Filter, projection bigtable.Filter) bigtable.Filter {
+	if projection == nil {
+		projection = bigtable.PassAllFilter()
+	}
+	fullRow := bigtable.ChainFilters(projection, bigtable.LabelFilter(fullRowLabel))
+	return bigtable.ConditionFilter(filter, bigtable.InterleaveFilters(filter, fullRow), nil)
 }
 
-func mapResult(rows []bigtable.Row, limit int) map[string][]bigtable.Timestamp {
-	resultMap := make(map[string][]bigtable.Timestamp)
-	for i, row := range rows {
-		for _, items := range row {
-			resultMap[row.Key()] = make([]bigtable.Timestamp, 0)
-			for _, item := range items {
-				resultMap[row.Key()] = append(resultMap[row.Key()], item.Timestamp)
+// searchRows reads the rows matching the filter in a single request (see searchFilter) and calls f with the key of
+// each row, the timestamps of the cells matched by the filter and the full row, restricted by the options of the call.
+// Returning false from f stops the read.
+func (r *Repository) searchRows(ctx context.Context, rowSet bigtable.RowSet, filter bigtable.Filter, o *callOptions, f func(key string, timestamps []bigtable.Timestamp, fullRow bigtable.Row) bool, opts ...bigtable.ReadOption) error {
+	opts = append([]bigtable.ReadOption{bigtable.RowFilter(searchFilter(filter, o.filter(r.mapper)))}, opts...)
+	return r.adapter.ReadRows(ctx, rowSet, func(row bigtable.Row) bool {
+		timestamps, fullRow := splitSearchRow(row)
+		if len(timestamps) == 0 {
+			return true
+		}
+		return f(row.Key(), timestamps, fullRow)
+	}, opts...)
+}
+
+// splitSearchRow separates the cells of a row read with searchFilter into the timestamps of the cells matched by the
+// filter and the full row, whose cells are stripped of fullRowLabel.
+func splitSearchRow(row bigtable.Row) ([]bigtable.Timestamp, bigtable.Row) {
+	timestamps := make([]bigtable.Timestamp, 0)
+	fullRow := make(bigtable.Row, len(row))
+	for family, items := range row {
+		for _, item := range items {
+			if !hasLabel(item, fullRowLabel) {
+				timestamps = append(timestamps, item.Timestamp)
+				continue
 			}
+			item.Labels = nil
+			fullRow[family] = append(fullRow[family], item)
 		}
-		if i > limit {
-			return resultMap
+	}
+	return timestamps, fullRow
+}
+
+func hasLabel(item bigtable.ReadItem, label string) bool {
+	for _, l := range item.Labels {
+		if l == label {
+			return true
 		}
 	}
-	return resultMap
+	return false
 }
 
 func filterReadItems(row bigtable.Row, ts []bigtable.Timestamp) map[string][]bigtable.ReadItem {
@@ -193,6 +455,11 @@ type Adapter interface {
 	ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error)
 	ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error)
 	ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) (errs []error, err error)
+	// CheckAndMutate atomically applies mtrue to the row if the filter matches at least one of its cells, mfalse otherwise,
+	// and reports whether the filter matched. Either mutation may be nil.
+	CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error)
+	// ApplyReadModifyWrite atomically applies the ReadModifyWrite to the row and returns the newly written cells.
+	ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error)
 }
 
 type bigTableAdapter struct {
@@ -211,6 +478,15 @@ func (a *bigTableAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts
 	return a.table.ApplyBulk(ctx, rowKeys, muts, opts...)
 }
 
+func (a *bigTableAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	err = a.table.Apply(ctx, row, bigtable.NewCondMutation(cond, mtrue, mfalse), bigtable.GetCondMutationResult(&matched))
+	return matched, err
+}
+
+func (a *bigTableAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	return a.table.ApplyReadModifyWrite(ctx, row, m)
+}
+
 // merge returns a new slice with the contents of both slices.
 func merge(a, b []string) []string {
 	m := make(map[string]bool)
@@ -5,7 +5,9 @@ import (
 	"embed"
 	"fmt"
 	"log"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"testing"
 	"time"
@@ -109,12 +111,12 @@ func ExampleRepository_Write() {
 		},
 	}}
 
-	errs, err := repo.Write(ctx, eventSet)
+	result, err := repo.Write(ctx, eventSet)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	if len(errs) > 0 {
-		log.Fatalln(errs)
+	if result.HasFailures() {
+		log.Fatalln(result.Errors())
 	}
 
 	row, err := tbl.ReadRow(ctx, "contact-101")
@@ -238,12 +240,12 @@ func ExampleRepository_Search() {
 			},
 		},
 	}}
-	errs, err := repo.Write(ctx, eventSet)
+	result, err := repo.Write(ctx, eventSet)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	if len(errs) > 0 {
-		log.Fatalln(errs)
+	if result.HasFailures() {
+		log.Fatalln(result.Errors())
 	}
 	readSet, err := repo.Search(ctx, bigtable.PrefixRange("contactx"), bigtable.CellsPerRowLimitFilter(1))
 	if err != nil {
@@ -336,12 +338,12 @@ func ExampleRepository_ReadLast() {
 	}}
 
 	// insert
-	errs, err := repo.Write(ctx, eventSet)
+	result, err := repo.Write(ctx, eventSet)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	if len(errs) > 0 {
-		log.Fatalln(errs)
+	if result.HasFailures() {
+		log.Fatalln(result.Errors())
 	}
 
 	// update
@@ -358,12 +360,12 @@ func ExampleRepository_ReadLast() {
 			},
 		},
 	}}
-	errs, err = repo.Write(ctx, eventSet)
+	result, err = repo.Write(ctx, eventSet)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	if len(errs) > 0 {
-		log.Fatalln(errs)
+	if result.HasFailures() {
+		log.Fatalln(result.Errors())
 	}
 
 	readSet, err := repo.ReadLast(ctx, "contactz-102")
@@ -421,12 +423,12 @@ func ExampleRepository_ReadFamily() {
 	}}
 
 	// insert
-	errs, err := repo.Write(ctx, eventSet)
+	result, err := repo.Write(ctx, eventSet)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	if len(errs) > 0 {
-		log.Fatalln(errs)
+	if result.HasFailures() {
+		log.Fatalln(result.Errors())
 	}
 
 	readSet, err := repo.ReadFamily(ctx, "contactz-102", "blog")
@@ -442,6 +444,56 @@ func ExampleRepository_ReadFamily() {
 	// Computer
 }
 
+func TestRepository_ReadBetween(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t))
+	day := func(d int) time.Time {
+		return time.Date(2021, time.March, d, 0, 0, 0, 0, time.UTC)
+	}
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "contactr-1", Date: day(1), Cells: map[string]string{"event_type": "page_view"}},
+			{RowKey: "contactr-1", Date: day(2), Cells: map[string]string{"event_type": "add_to_cart"}},
+			{RowKey: "contactr-1", Date: day(3), Cells: map[string]string{"event_type": "purchase"}},
+		},
+		"blog": {
+			{RowKey: "contactr-1", Date: day(2), Cells: map[string]string{"event_type": "page_view"}},
+		},
+	}}
+	result, err := repo.Write(ctx, eventSet)
+	if err != nil || result.HasFailures() {
+		t.Fatalf("failed to write: %v %v", err, result.Errors())
+	}
+
+	readSet, err := repo.ReadBetween(ctx, "contactr-1", day(2), day(3))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(readSet.Events["front"]) != 1 || len(readSet.Events["blog"]) != 1 {
+		t.Fatalf("expected 1 event per family, got %d and %d", len(readSet.Events["front"]), len(readSet.Events["blog"]))
+	}
+	if v := readSet.Events["front"][0].Cells["event_type"]; v != "add_to_cart" {
+		t.Fatalf("expected add_to_cart, got %s", v)
+	}
+
+	readSet, err = repo.ReadSince(ctx, "contactr-1", day(2), NewFamilyOption("front"))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(readSet.Events) != 1 {
+		t.Fatalf("expected 1 event family, got %d", len(readSet.Events))
+	}
+	if len(readSet.Events["front"]) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(readSet.Events["front"]))
+	}
+	for _, event := range readSet.Events["front"] {
+		if event.Date.Before(day(2)) {
+			t.Fatalf("unexpected event at %s", event.Date)
+		}
+	}
+}
+
 var t1 = bigtable.Time(time.Date(2020, time.January, 1, 0, 1, 0, 0, time.UTC))
 var t2 = bigtable.Time(time.Date(2020, time.January, 1, 0, 2, 0, 0, time.UTC))
 var t3 = bigtable.Time(time.Date(2020, time.January, 1, 0, 3, 0, 0, time.UTC))
@@ -545,6 +597,216 @@ func TestRepository_Search(t *testing.T) {
 
 }
 
+// countingScanAdapter counts the requests sent to the wrapped adapter to read rows.
+type countingScanAdapter struct {
+	Adapter
+	readRow  int
+	readRows int
+}
+
+func (a *countingScanAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	a.readRow++
+	return a.Adapter.ReadRow(ctx, row, opts...)
+}
+
+func (a *countingScanAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) error {
+	a.readRows++
+	return a.Adapter.ReadRows(ctx, arg, f, opts...)
+}
+
+func TestRepository_SearchSinglePass(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repository := NewRepository(client.Open(table), getMockMapper(t))
+	adapter := &countingScanAdapter{Adapter: repository.adapter}
+	repository.adapter = adapter
+
+	// the filter may apply its own label, it doesn't interfere with the full row
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"), bigtable.LabelFilter("purchase"))
+	eventSet, err := repository.Search(ctx, bigtable.PrefixRange("contact-"), filter)
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if adapter.readRows != 1 || adapter.readRow != 0 {
+		t.Fatalf("expected a single ReadRows, got %d ReadRows and %d ReadRow", adapter.readRows, adapter.readRow)
+	}
+	if len(eventSet.Events["front"]) != 50 {
+		t.Fatalf("expected 50 events, got %d", len(eventSet.Events["front"]))
+	}
+	for _, event := range eventSet.Events["front"] {
+		if event.Cells["event_type"] != "purchase" || event.Cells["url"] == "" || event.Cells["device_type"] == "" {
+			t.Fatalf("expected a purchase with all its cells, got %v", event.Cells)
+		}
+	}
+
+	// the limit of rows is still pushed down to Big Table
+	repository.maxRows = 2
+	eventSet, err = repository.Search(ctx, bigtable.RowRange{}, bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13")))
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(eventSet.Events["front"]) != 10 {
+		t.Fatalf("expected the 10 events of 2 rows, got %d", len(eventSet.Events["front"]))
+	}
+}
+
+// optionsAdapter records the options given to ReadRows.
+type optionsAdapter struct {
+	mockAdapter
+	opts []bigtable.ReadOption
+}
+
+func (a *optionsAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) error {
+	a.opts = opts
+	return a.mockAdapter.ReadRows(ctx, arg, f, opts...)
+}
+
+func TestRepository_SearchUnlimited(t *testing.T) {
+	ctx := context.Background()
+	limitType := reflect.TypeOf(bigtable.LimitRows(0))
+	for _, maxRows := range []int{0, -1} {
+		adapter := &optionsAdapter{}
+		repository := NewRepositoryWithAdapter(adapter, getMockMapper(t), NewMaxRowsOption(maxRows))
+		if _, err := repository.Search(ctx, bigtable.RowRange{}, bigtable.ColumnFilter("d")); err != nil {
+			t.Fatalf("failed to search: %v", err)
+		}
+		for _, opt := range adapter.opts {
+			if reflect.TypeOf(opt) == limitType {
+				t.Fatalf("expected no row limit for %d, got %v", maxRows, opt)
+			}
+		}
+	}
+}
+
+func BenchmarkRepository_Search(b *testing.B) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repository := NewRepository(client.Open(table), getMockMapper(b))
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repository.Search(ctx, bigtable.PrefixRange("contact-"), filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRepository_SearchReadRowPerKey measures the former implementation of Search which issued one ReadRow per matched key.
+func BenchmarkRepository_SearchReadRowPerKey(b *testing.B) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repository := NewRepository(client.Open(table), getMockMapper(b))
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matched := scanMatchedTimestamps(ctx, b, repository, filter)
+		result := make([]bigtable.Row, 0, len(matched))
+		for key, ts := range matched {
+			fullRow, err := repository.adapter.ReadRow(ctx, key)
+			if err != nil {
+				b.Fatal(err)
+			}
+			result = append(result, filterReadItems(fullRow, ts))
+		}
+		buildEventSet(result, repository.mapper)
+	}
+}
+
+// BenchmarkRepository_SearchTwoPasses measures the former implementation of Search which read the matched rows again
+// in a single batched request.
+func BenchmarkRepository_SearchTwoPasses(b *testing.B) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repository := NewRepository(client.Open(table), getMockMapper(b))
+	filter := bigtable.ChainFilters(bigtable.ColumnFilter("e"), bigtable.ValueFilter("13"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matched := scanMatchedTimestamps(ctx, b, repository, filter)
+		keys := make(bigtable.RowList, 0, len(matched))
+		for key := range matched {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		result := make([]bigtable.Row, 0, len(matched))
+		err := repository.adapter.ReadRows(ctx, keys, func(row bigtable.Row) bool {
+			result = append(result, filterReadItems(row, matched[row.Key()]))
+			return true
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		buildEventSet(result, repository.mapper)
+	}
+}
+
+// scanMatchedTimestamps is the first pass of the former implementations of Search, returning the timestamps of the
+// cells matched by the filter in each row.
+func scanMatchedTimestamps(ctx context.Context, b *testing.B, repository *Repository, filter bigtable.Filter) map[string][]bigtable.Timestamp {
+	matched := make(map[string][]bigtable.Timestamp)
+	err := repository.adapter.ReadRows(ctx, bigtable.PrefixRange("contact-"), func(row bigtable.Row) bool {
+		for _, items := range row {
+			for _, item := range items {
+				matched[row.Key()] = append(matched[row.Key()], item.Timestamp)
+			}
+		}
+		return true
+	}, bigtable.RowFilter(filter))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return matched
+}
+
+func TestRepository_SearchIter(t *testing.T) {
+	ctx := context.Background()
+	repository := &Repository{
+		adapter: mockAdapter{},
+		mapper:  getMockMapper(t),
+	}
+	var sets []*data.Set
+	err := repository.SearchIter(ctx, bigtable.RowRange{}, bigtable.ColumnFilter("d"), func(set *data.Set) bool {
+		sets = append(sets, set)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(sets))
+	}
+	if v := sets[0].Events["front"]; len(v) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(v))
+	}
+
+	client := getBigTableClient(ctx)
+	repository = NewRepository(client.Open(table), getMockMapper(t))
+	rows := 0
+	err = repository.SearchIter(ctx, bigtable.PrefixRange("contact-"), bigtable.LatestNFilter(1), func(set *data.Set) bool {
+		rows++
+		return rows < 3
+	})
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if rows != 3 {
+		t.Fatalf("expected the iteration to stop after 3 rows, got %d", rows)
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	rows = 0
+	err = repository.SearchIter(cancelCtx, bigtable.PrefixRange("contact-"), bigtable.LatestNFilter(1), func(set *data.Set) bool {
+		rows++
+		cancel()
+		return true
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if rows != 1 {
+		t.Fatalf("expected the iteration to stop after 1 row, got %d", rows)
+	}
+}
+
 func TestRepository_ReadLast(t *testing.T) {
 	ctx := context.Background()
 	repository := &Repository{
@@ -653,7 +915,7 @@ func TestRepository_ReadFamily(t *testing.T) {
 //go:embed testdata/mapping.json
 var fs embed.FS
 
-func getMockMapper(t *testing.T) *mapping.Mapper {
+func getMockMapper(t testing.TB) *mapping.Mapper {
 	c, err := fs.ReadFile("testdata/mapping.json")
 	if err != nil {
 		t.Fatalf("failed to read mapping.json: %v", err)
@@ -667,8 +929,26 @@ func getMockMapper(t *testing.T) *mapping.Mapper {
 
 type mockAdapter struct{}
 
-func (a mockAdapter) ReadRows(_ context.Context, _ bigtable.RowSet, f func(bigtable.Row) bool, _ ...bigtable.ReadOption) (err error) {
+func (a mockAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, _ ...bigtable.ReadOption) (err error) {
+	// a list of keys is used by the repository to fetch full rows
+	if keys, ok := arg.(bigtable.RowList); ok {
+		for _, key := range keys {
+			row, _ := a.ReadRow(ctx, key)
+			if !f(row) {
+				return nil
+			}
+		}
+		return nil
+	}
+	// the rows matched by a search are returned along with their full row labelled as searchFilter does
 	for _, row := range getRows() {
+		fullRow, _ := a.ReadRow(ctx, row.Key())
+		for family, items := range fullRow {
+			for _, item := range items {
+				item.Labels = []string{fullRowLabel}
+				row[family] = append(row[family], item)
+			}
+		}
 		f(row)
 	}
 	return nil
@@ -767,6 +1047,14 @@ func (a mockAdapter) ApplyBulk(_ context.Context, _ []string, _ []*bigtable.Muta
 	return nil, nil
 }
 
+func (a mockAdapter) CheckAndMutate(_ context.Context, _ string, _ bigtable.Filter, _, _ *bigtable.Mutation) (matched bool, err error) {
+	return false, nil
+}
+
+func (a mockAdapter) ApplyReadModifyWrite(_ context.Context, _ string, _ *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	return bigtable.Row{}, nil
+}
+
 func getBigTableClient(ctx context.Context) *bigtable.Client {
 	srv, err := bttest.NewServer("localhost:0")
 	if err != nil {
@@ -837,3 +1125,52 @@ func generateMutations(numEvents int) []*bigtable.Mutation {
 	}
 	return data
 }
+
+func TestRepository_Exists(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t))
+
+	exists, err := repo.Exists(ctx, "contact-3")
+	if err != nil || !exists {
+		t.Fatalf("expected contact-3 to exist, got %v %v", exists, err)
+	}
+	exists, err = repo.Exists(ctx, "contact-unknown")
+	if err != nil || exists {
+		t.Fatalf("expected contact-unknown not to exist, got %v %v", exists, err)
+	}
+
+	if _, err = repo.Read(ctx, "contact-unknown"); err != ErrRowNotFound {
+		t.Fatalf("expected ErrRowNotFound, got %v", err)
+	}
+	if _, err = repo.ReadFamily(ctx, "contact-unknown", "front"); err != ErrRowNotFound {
+		t.Fatalf("expected ErrRowNotFound, got %v", err)
+	}
+	// an existing row in which no cell matches the filter is not a missing row, which is told in a single request
+	adapter := &countingScanAdapter{Adapter: repo.adapter}
+	repo.adapter = adapter
+	eventSet, err := repo.ReadFamily(ctx, "contact-3", "unknown-family")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(eventSet.Events) != 0 {
+		t.Fatalf("expected no events, got %d families", len(eventSet.Events))
+	}
+	if adapter.readRow != 1 {
+		t.Fatalf("expected a single request, got %d", adapter.readRow)
+	}
+	// the first cell of the row is not mixed with the events read
+	eventSet, err = repo.ReadFamily(ctx, "contact-3", "front", NewColumnsOption("url"))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	for _, event := range eventSet.Events["front"] {
+		if len(event.Cells) != 1 || event.Cells["url"] == "" {
+			t.Fatalf("expected only the url of the events, got %v", event.Cells)
+		}
+	}
+	_, errs := repo.ReadMany(ctx, []string{"contact-3", "contact-unknown"})
+	if len(errs) != 1 || errs["contact-unknown"] != ErrRowNotFound {
+		t.Fatalf("expected ErrRowNotFound for contact-unknown only, got %v", errs)
+	}
+}
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy describes how the RetryAdapter retries the calls that failed.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the delay after each attempt.
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1.
+	Jitter float64
+	// RetryableCodes are the gRPC codes of the errors that are retried.
+	RetryableCodes []codes.Code
+}
+
+// DefaultRetryPolicy returns a RetryPolicy retrying the transient errors of Big Table up to 5 times.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.Aborted},
+	}
+}
+
+/*
+RetryAdapter is an Adapter that retries the calls of the adapter it wraps when they fail with a retryable error,
+waiting for an exponential backoff with jitter between the attempts.
+
+  - ReadRow is retried as a whole.
+  - ReadRows resumes after the last row delivered to the callback, so the callback never sees the same row twice.
+  - ApplyBulk only retries the entries that failed with a retryable error.
+  - CheckAndMutate and ApplyReadModifyWrite are not idempotent and are never retried.
+*/
+type RetryAdapter struct {
+	adapter Adapter
+	policy  RetryPolicy
+	sleep   func(ctx context.Context, d time.Duration) error
+	random  func() float64
+}
+
+func NewRetryAdapter(adapter Adapter, policy RetryPolicy) *RetryAdapter {
+	return &RetryAdapter{
+		adapter: adapter,
+		policy:  policy,
+		sleep:   sleep,
+		random:  rand.Float64, // #nosec G404 -- the jitter doesn't need a secure random generator
+	}
+}
+
+type RetryAdapterOption struct {
+	policy RetryPolicy
+}
+
+func NewRetryAdapterOption(policy RetryPolicy) *RetryAdapterOption {
+	return &RetryAdapterOption{
+		policy: policy,
+	}
+}
+
+func (opt *RetryAdapterOption) apply(repo *Repository) {
+	repo.adapter = NewRetryAdapter(repo.adapter, opt.policy)
+}
+
+func (a *RetryAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	var btRow bigtable.Row
+	err := a.retry(ctx, func() error {
+		var err error
+		btRow, err = a.adapter.ReadRow(ctx, row, opts...)
+		return err
+	})
+	return btRow, err
+}
+
+func (a *RetryAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) (err error) {
+	limit, hasLimit := rowsLimit(opts)
+	var delivered int64
+	lastKey := ""
+	return a.retry(ctx, func() error {
+		attemptArg := arg
+		attemptOpts := opts
+		if lastKey != "" {
+			var err error
+			if attemptArg, err = retainRowsAfter(arg, lastKey); err != nil {
+				return err
+			}
+			valid, err := rowSetValid(attemptArg)
+			if err != nil || !valid {
+				return err
+			}
+			if hasLimit {
+				if limit <= delivered {
+					return nil
+				}
+				attemptOpts = withRowsLimit(opts, limit-delivered)
+			}
+		}
+		return a.adapter.ReadRows(ctx, attemptArg, func(row bigtable.Row) bool {
+			lastKey = row.Key()
+			delivered++
+			return f(row)
+		}, attemptOpts...)
+	})
+}
+
+func (a *RetryAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) (errs []error, err error) {
+	// pending holds the indexes of the entries that still have to be applied
+	pending := make([]int, len(rowKeys))
+	for i := range pending {
+		pending[i] = i
+	}
+	errs = make([]error, len(rowKeys))
+	var bulkErr error
+	_ = a.retry(ctx, func() error {
+		keys := make([]string, len(pending))
+		mutations := make([]*bigtable.Mutation, len(pending))
+		for i, index := range pending {
+			keys[i] = rowKeys[index]
+			mutations[i] = muts[index]
+		}
+		attemptErrs, err := a.adapter.ApplyBulk(ctx, keys, mutations, opts...)
+		if bulkErr = err; err != nil {
+			return err
+		}
+		var retryable []int
+		var lastErr error
+		for i, index := range pending {
+			errs[index] = nil
+			if i < len(attemptErrs) && attemptErrs[i] != nil {
+				errs[index] = attemptErrs[i]
+				if a.retryable(attemptErrs[i]) {
+					retryable = append(retryable, index)
+					lastErr = attemptErrs[i]
+				}
+			}
+		}
+		pending = retryable
+		// returning the error of a failed entry triggers a new attempt for the pending entries
+		return lastErr
+	})
+	if bulkErr != nil {
+		if len(pending) == len(rowKeys) {
+			return nil, bulkErr
+		}
+		// some entries have been applied by the previous attempts, only the pending ones failed
+		for _, index := range pending {
+			errs[index] = bulkErr
+		}
+	}
+	for _, e := range errs {
+		if e != nil {
+			return errs, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a *RetryAdapter) CheckAndMutate(ctx context.Context, row string, cond bigtable.Filter, mtrue, mfalse *bigtable.Mutation) (matched bool, err error) {
+	return a.adapter.CheckAndMutate(ctx, row, cond, mtrue, mfalse)
+}
+
+func (a *RetryAdapter) ApplyReadModifyWrite(ctx context.Context, row string, m *bigtable.ReadModifyWrite) (bigtable.Row, error) {
+	return a.adapter.ApplyReadModifyWrite(ctx, row, m)
+}
+
+// retry calls f until it succeeds, fails with an error that is not retryable or the maximum number of attempts is reached.
+func (a *RetryAdapter) retry(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = f()
+		if err == nil || !a.retryable(err) || attempt+1 >= a.policy.MaxAttempts {
+			return err
+		}
+		if sleepErr := a.sleep(ctx, a.backoff(attempt)); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func (a *RetryAdapter) retryable(err error) bool {
+	code := status.Code(err)
+	for _, c := range a.policy.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay to wait after the given attempt, starting at 0.
+func (a *RetryAdapter) backoff(attempt int) time.Duration {
+	multiplier := a.policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(a.policy.InitialBackoff) * math.Pow(multiplier, float64(attempt))
+	if a.policy.MaxBackoff > 0 && d > float64(a.policy.MaxBackoff) {
+		d = float64(a.policy.MaxBackoff)
+	}
+	// the jitter spreads the delay evenly around its nominal value
+	d += d * a.policy.Jitter * (2*a.random() - 1)
+	return time.Duration(d)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rowsLimit returns the limit set with bigtable.LimitRows if any. The option is opaque, so its value is read by reflection.
+func rowsLimit(opts []bigtable.ReadOption) (int64, bool) {
+	limitType := reflect.TypeOf(bigtable.LimitRows(0))
+	for _, opt := range opts {
+		if reflect.TypeOf(opt) == limitType {
+			limit := reflect.ValueOf(opt).Field(0).Int()
+			// a limit of zero means no limit
+			return limit, limit > 0
+		}
+	}
+	return 0, false
+}
+
+// withRowsLimit replaces the limit set with bigtable.LimitRows by the given one.
+func withRowsLimit(opts []bigtable.ReadOption, limit int64) []bigtable.ReadOption {
+	limitType := reflect.TypeOf(bigtable.LimitRows(0))
+	result := make([]bigtable.ReadOption, 0, len(opts))
+	for _, opt := range opts {
+		if reflect.TypeOf(opt) != limitType {
+			result = append(result, opt)
+		}
+	}
+	return append(result, bigtable.LimitRows(limit))
+}
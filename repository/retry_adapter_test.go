@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// faultyAdapter serves a fixed list of rows and fails the calls as scripted by its fields.
+type faultyAdapter struct {
+	mockAdapter
+	keys []string
+	// readRowErrs are returned by the successive calls to ReadRow
+	readRowErrs []error
+	// readRowsFailAfter makes the first call to ReadRows fail after having delivered that many rows
+	readRowsFailAfter int
+	readRowsCalls     []bigtable.RowSet
+	// bulkErrs returns the errors of the entries for each call to ApplyBulk
+	bulkErrs  func(call int, rowKeys []string) []error
+	bulkCalls [][]string
+}
+
+func (a *faultyAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	if len(a.readRowErrs) > 0 {
+		err := a.readRowErrs[0]
+		a.readRowErrs = a.readRowErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a.mockAdapter.ReadRow(ctx, row, opts...)
+}
+
+func (a *faultyAdapter) ReadRows(_ context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) error {
+	a.readRowsCalls = append(a.readRowsCalls, arg)
+	limit, hasLimit := rowsLimit(opts)
+	delivered := 0
+	for _, key := range a.keys {
+		if !containsKey(arg, key) {
+			continue
+		}
+		if len(a.readRowsCalls) == 1 && delivered == a.readRowsFailAfter {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		if hasLimit && int64(delivered) == limit {
+			return nil
+		}
+		delivered++
+		if !f(bigtable.Row{"front": {{Row: key, Column: "front:d", Value: []byte("1")}}}) {
+			return nil
+		}
+	}
+	if len(a.readRowsCalls) == 1 && delivered == a.readRowsFailAfter {
+		return status.Error(codes.Unavailable, "unavailable")
+	}
+	return nil
+}
+
+// containsKey tells whether a bigtable.RowList or a bigtable.RowRange contains the key.
+func containsKey(rowSet bigtable.RowSet, key string) bool {
+	if keys, ok := rowSet.(bigtable.RowList); ok {
+		for _, k := range keys {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}
+	return rowSet.(bigtable.RowRange).Contains(key)
+}
+
+func (a *faultyAdapter) ApplyBulk(_ context.Context, rowKeys []string, _ []*bigtable.Mutation, _ ...bigtable.ApplyOption) ([]error, error) {
+	a.bulkCalls = append(a.bulkCalls, rowKeys)
+	errs := a.bulkErrs(len(a.bulkCalls), rowKeys)
+	return errs, nil
+}
+
+func newTestRetryAdapter(adapter Adapter) (*RetryAdapter, *[]time.Duration) {
+	policy := DefaultRetryPolicy()
+	policy.Jitter = 0
+	retry := NewRetryAdapter(adapter, policy)
+	var sleeps []time.Duration
+	retry.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return retry, &sleeps
+}
+
+func TestRetryAdapter_ReadRow(t *testing.T) {
+	ctx := context.Background()
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	adapter := &faultyAdapter{readRowErrs: []error{unavailable, unavailable}}
+	retry, sleeps := newTestRetryAdapter(adapter)
+	row, err := retry.ReadRow(ctx, "contact-1")
+	if err != nil {
+		t.Fatalf("expected the read to succeed, got %v", err)
+	}
+	if row.Key() != "contact-1" {
+		t.Fatalf("unexpected row %s", row.Key())
+	}
+	if len(*sleeps) != 2 || (*sleeps)[0] != 100*time.Millisecond || (*sleeps)[1] != 200*time.Millisecond {
+		t.Fatalf("unexpected backoff %v", *sleeps)
+	}
+
+	adapter = &faultyAdapter{readRowErrs: []error{status.Error(codes.NotFound, "not found")}}
+	retry, sleeps = newTestRetryAdapter(adapter)
+	if _, err = retry.ReadRow(ctx, "contact-1"); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	if len(*sleeps) != 0 {
+		t.Fatal("a non-retryable error should not be retried")
+	}
+
+	adapter = &faultyAdapter{readRowErrs: []error{unavailable, unavailable, unavailable, unavailable, unavailable, unavailable}}
+	retry, sleeps = newTestRetryAdapter(adapter)
+	if _, err = retry.ReadRow(ctx, "contact-1"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+	if len(*sleeps) != 4 {
+		t.Fatalf("expected 5 attempts, got %d", len(*sleeps)+1)
+	}
+}
+
+func TestRetryAdapter_ReadRows(t *testing.T) {
+	ctx := context.Background()
+	keys := []string{"contact-1", "contact-2", "contact-3", "contact-4", "contact-5"}
+	adapter := &faultyAdapter{keys: keys, readRowsFailAfter: 2}
+	retry, _ := newTestRetryAdapter(adapter)
+	var seen []string
+	err := retry.ReadRows(ctx, bigtable.PrefixRange("contact-"), func(row bigtable.Row) bool {
+		seen = append(seen, row.Key())
+		return true
+	})
+	if err != nil {
+		t.Fatalf("expected the read to succeed, got %v", err)
+	}
+	if len(seen) != 5 || !sort.StringsAreSorted(seen) || seen[2] != "contact-3" {
+		t.Fatalf("expected each row once, got %v", seen)
+	}
+	if len(adapter.readRowsCalls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(adapter.readRowsCalls))
+	}
+	if adapter.readRowsCalls[1].(bigtable.RowRange).Contains("contact-2") {
+		t.Fatal("the second call should resume after the last delivered row")
+	}
+
+	adapter = &faultyAdapter{keys: keys, readRowsFailAfter: 2}
+	retry, _ = newTestRetryAdapter(adapter)
+	seen = nil
+	err = retry.ReadRows(ctx, bigtable.PrefixRange("contact-"), func(row bigtable.Row) bool {
+		seen = append(seen, row.Key())
+		return true
+	}, bigtable.LimitRows(3))
+	if err != nil {
+		t.Fatalf("expected the read to succeed, got %v", err)
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected the limit to be kept across attempts, got %v", seen)
+	}
+
+	// a single row already delivered leaves nothing to read
+	adapter = &faultyAdapter{keys: keys, readRowsFailAfter: 1}
+	retry, _ = newTestRetryAdapter(adapter)
+	seen = nil
+	err = retry.ReadRows(ctx, bigtable.SingleRow("contact-3"), func(row bigtable.Row) bool {
+		seen = append(seen, row.Key())
+		return true
+	})
+	if err != nil {
+		t.Fatalf("expected the read to succeed, got %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "contact-3" || len(adapter.readRowsCalls) != 1 {
+		t.Fatalf("expected contact-3 once in a single call, got %v in %d calls", seen, len(adapter.readRowsCalls))
+	}
+
+	// a single row not delivered yet is read again
+	adapter = &faultyAdapter{keys: keys}
+	retry, _ = newTestRetryAdapter(adapter)
+	seen = nil
+	err = retry.ReadRows(ctx, bigtable.SingleRow("contact-3"), func(row bigtable.Row) bool {
+		seen = append(seen, row.Key())
+		return true
+	})
+	if err != nil {
+		t.Fatalf("expected the read to succeed, got %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "contact-3" || len(adapter.readRowsCalls) != 2 {
+		t.Fatalf("expected contact-3 once after a retry, got %v in %d calls", seen, len(adapter.readRowsCalls))
+	}
+}
+
+func TestRetryAdapter_ApplyBulk(t *testing.T) {
+	ctx := context.Background()
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	invalid := status.Error(codes.InvalidArgument, "invalid")
+	adapter := &faultyAdapter{
+		bulkErrs: func(call int, rowKeys []string) []error {
+			errs := make([]error, len(rowKeys))
+			for i, key := range rowKeys {
+				switch {
+				case key == "invalid":
+					errs[i] = invalid
+				case key == "flaky" && call < 3:
+					errs[i] = unavailable
+				}
+			}
+			return errs
+		},
+	}
+	retry, _ := newTestRetryAdapter(adapter)
+	rowKeys := []string{"ok", "flaky", "invalid"}
+	errs, err := retry.ApplyBulk(ctx, rowKeys, make([]*bigtable.Mutation, len(rowKeys)))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || errs[2] != invalid {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if len(adapter.bulkCalls) != 3 {
+		t.Fatalf("expected 3 calls, got %d", len(adapter.bulkCalls))
+	}
+	for _, call := range adapter.bulkCalls[1:] {
+		if len(call) != 1 || call[0] != "flaky" {
+			t.Fatalf("only the flaky entry should be retried, got %v", call)
+		}
+	}
+}
+
+func TestRetryAdapterOption(t *testing.T) {
+	ctx := context.Background()
+	client := getBigTableClient(ctx)
+	repo := NewRepository(client.Open(table), getMockMapper(t), NewRetryAdapterOption(DefaultRetryPolicy()))
+	if _, ok := repo.adapter.(*RetryAdapter); !ok {
+		t.Fatalf("expected a RetryAdapter, got %T", repo.adapter)
+	}
+	eventSet, err := repo.Read(ctx, "contact-3")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if len(eventSet.Events["front"]) != 100 {
+		t.Fatalf("expected 100 events, got %d", len(eventSet.Events["front"]))
+	}
+}
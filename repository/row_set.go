@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/pkg/errors"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+)
+
+// retainRowsFrom returns a new RowSet that does not include any row key lexicographically less than the given one.
+// Big Table provides the same logic for its own retries but doesn't export it.
+func retainRowsFrom(rowSet bigtable.RowSet, key string) (bigtable.RowSet, error) {
+	switch set := rowSet.(type) {
+	case bigtable.RowList:
+		// bigtable.SingleRow is a RowList of one key too, so a row already delivered leaves an empty list
+		keys := make(bigtable.RowList, 0, len(set))
+		for _, k := range set {
+			if k >= key {
+				keys = append(keys, k)
+			}
+		}
+		return keys, nil
+	case bigtable.RowRange:
+		return retainRangeFrom(set, key)
+	case bigtable.RowRangeList:
+		ranges := make(bigtable.RowRangeList, 0, len(set))
+		for _, rr := range set {
+			retained, err := retainRangeFrom(rr, key)
+			if err != nil {
+				return nil, err
+			}
+			valid, err := rangeValid(retained)
+			if err != nil {
+				return nil, err
+			}
+			if valid {
+				ranges = append(ranges, retained)
+			}
+		}
+		return ranges, nil
+	default:
+		return nil, errors.Errorf("unsupported row set %T", rowSet)
+	}
+}
+
+func retainRangeFrom(rr bigtable.RowRange, key string) (bigtable.RowRange, error) {
+	start, limit, err := rangeBounds(rr)
+	if err != nil {
+		return bigtable.RowRange{}, err
+	}
+	if key <= start {
+		return rr, nil
+	}
+	if rr.Unbounded() {
+		return bigtable.InfiniteRange(key), nil
+	}
+	return bigtable.NewRange(key, limit), nil
+}
+
+// rangeBounds returns the bounds of a bigtable.RowRange, which are not exported, by parsing its description of the
+// form ["start","limit") or ["start",∞). The limit is empty when the range is unbounded.
+func rangeBounds(rr bigtable.RowRange) (start, limit string, err error) {
+	description := rr.String()
+	if !strings.HasPrefix(description, "[") || !strings.HasSuffix(description, ")") {
+		return "", "", errors.Errorf("unsupported row range %s", description)
+	}
+	bounds := strings.TrimSuffix(strings.TrimPrefix(description, "["), ")")
+	quotedStart, err := strconv.QuotedPrefix(bounds)
+	if err != nil {
+		return "", "", errors.Errorf("unsupported row range %s", description)
+	}
+	if start, err = strconv.Unquote(quotedStart); err != nil {
+		return "", "", errors.Errorf("unsupported row range %s", description)
+	}
+	quotedLimit := strings.TrimPrefix(bounds[len(quotedStart):], ",")
+	if rr.Unbounded() {
+		return start, "", nil
+	}
+	if limit, err = strconv.Unquote(quotedLimit); err != nil {
+		return "", "", errors.Errorf("unsupported row range %s", description)
+	}
+	return start, limit, nil
+}
+
+// retainRowsAfter returns a new RowSet that does not include the given row key or any row key lexicographically less than it.
+func retainRowsAfter(rowSet bigtable.RowSet, key string) (bigtable.RowSet, error) {
+	return retainRowsFrom(rowSet, key+"\x00")
+}
+
+// rowSetValid reports whether the RowSet can cover at least one row.
+func rowSetValid(rowSet bigtable.RowSet) (bool, error) {
+	switch set := rowSet.(type) {
+	case bigtable.RowList:
+		return len(set) > 0, nil
+	case bigtable.RowRange:
+		return rangeValid(set)
+	case bigtable.RowRangeList:
+		for _, rr := range set {
+			valid, err := rangeValid(rr)
+			if err != nil || valid {
+				return valid, err
+			}
+		}
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+func rangeValid(rr bigtable.RowRange) (bool, error) {
+	if rr.Unbounded() {
+		return true, nil
+	}
+	start, limit, err := rangeBounds(rr)
+	if err != nil {
+		return false, err
+	}
+	return start < limit, nil
+}
+
+// rowSetProto returns the protocol buffer the Big Table client sends for a bigtable.RowSet.
+func rowSetProto(rowSet bigtable.RowSet) (*btpb.RowSet, error) {
+	switch set := rowSet.(type) {
+	case bigtable.RowList:
+		keys := make([][]byte, len(set))
+		for i, key := range set {
+			keys[i] = []byte(key)
+		}
+		return &btpb.RowSet{RowKeys: keys}, nil
+	case bigtable.RowRange:
+		rr, err := rowRangeProto(set)
+		if err != nil {
+			return nil, err
+		}
+		return &btpb.RowSet{RowRanges: []*btpb.RowRange{rr}}, nil
+	case bigtable.RowRangeList:
+		ranges := make([]*btpb.RowRange, len(set))
+		for i, rr := range set {
+			var err error
+			if ranges[i], err = rowRangeProto(rr); err != nil {
+				return nil, err
+			}
+		}
+		return &btpb.RowSet{RowRanges: ranges}, nil
+	}
+	return nil, errors.Errorf("unsupported row set %T", rowSet)
+}
+
+// rowRangeProto returns the protocol buffer of a bigtable.RowRange, whose start is closed and limit open.
+func rowRangeProto(rr bigtable.RowRange) (*btpb.RowRange, error) {
+	start, limit, err := rangeBounds(rr)
+	if err != nil {
+		return nil, err
+	}
+	result := &btpb.RowRange{}
+	if start != "" {
+		result.StartKey = &btpb.RowRange_StartKeyClosed{StartKeyClosed: []byte(start)}
+	}
+	if limit != "" {
+		result.EndKey = &btpb.RowRange_EndKeyOpen{EndKeyOpen: []byte(limit)}
+	}
+	return result, nil
+}
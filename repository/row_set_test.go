@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigtable"
+)
+
+func TestRetainRowsFrom(t *testing.T) {
+	set, err := retainRowsFrom(bigtable.PrefixRange("contact-"), "contact-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := set.(bigtable.RowRange)
+	if rr.Contains("contact-4") || !rr.Contains("contact-5") || !rr.Contains("contact-9") || rr.Contains("contacu") {
+		t.Fatalf("unexpected range %s", rr)
+	}
+	set, err = retainRowsFrom(bigtable.RowList{"a", "b", "c"}, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.(bigtable.RowList)) != 2 {
+		t.Fatalf("unexpected list %v", set)
+	}
+	set, err = retainRowsFrom(bigtable.RowRangeList{bigtable.NewRange("a", "b"), bigtable.NewRange("c", "d")}, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.(bigtable.RowRangeList)) != 1 {
+		t.Fatalf("unexpected list %v", set)
+	}
+}
+
+func TestRetainRowsAfter(t *testing.T) {
+	set, err := retainRowsAfter(bigtable.PrefixRange("contact-"), "contact-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := set.(bigtable.RowRange)
+	if rr.Contains("contact-5") || !rr.Contains("contact-6") {
+		t.Fatalf("unexpected range %s", rr)
+	}
+	set, err = retainRowsAfter(bigtable.RowList{"a", "b"}, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := rowSetValid(set); err != nil || valid {
+		t.Fatalf("expected an empty row set, got %v", set)
+	}
+	if valid, err := rowSetValid(bigtable.RowRange{}); err != nil || !valid {
+		t.Fatal("an infinite range is valid")
+	}
+}
+
+func TestRangeBounds(t *testing.T) {
+	tests := []struct {
+		rr           bigtable.RowRange
+		start, limit string
+	}{
+		{rr: bigtable.NewRange("contact-1", "contact-5"), start: "contact-1", limit: "contact-5"},
+		{rr: bigtable.PrefixRange("contact-"), start: "contact-", limit: "contact."},
+		{rr: bigtable.InfiniteRange("contact-3"), start: "contact-3"},
+		{rr: bigtable.RowRange{}},
+		{rr: bigtable.NewRange("a,\"b\")", "c\x00∞"), start: "a,\"b\")", limit: "c\x00∞"},
+	}
+	for _, test := range tests {
+		start, limit, err := rangeBounds(test.rr)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", test.rr, err)
+		}
+		if start != test.start || limit != test.limit {
+			t.Errorf("expected the bounds %q and %q for %s, got %q and %q", test.start, test.limit, test.rr, start, limit)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Timeouts are the default timeouts of the operations of the Repository. A zero timeout means no timeout, in which
+// case the operation only ends with the caller's context.
+type Timeouts struct {
+	// Read applies to the reads of rows by their key: Read, ReadFamily, ReadLast, ReadBetween, ReadSince, ReadAsOf,
+	// ReadRow and Exists. ReadMany applies it to each row.
+	Read time.Duration
+	// Scan applies to the reads of ranges of rows: Search, SearchPage and SearchIter.
+	Scan time.Duration
+	// Write applies to Write, WriteIf, DeleteEvents, DeleteRow, DeleteFamily and Increment.
+	Write time.Duration
+}
+
+// TimeoutsOption sets the default timeouts of the operations of the repository.
+type TimeoutsOption struct {
+	timeouts Timeouts
+}
+
+func NewTimeoutsOption(timeouts Timeouts) TimeoutsOption {
+	return TimeoutsOption{timeouts: timeouts}
+}
+
+func (o TimeoutsOption) apply(r *Repository) {
+	r.timeouts = o.timeouts
+}
+
+// TimeoutOption overrides the default timeout of the operation for a single call. A zero timeout means no timeout.
+type TimeoutOption struct {
+	timeout time.Duration
+}
+
+func NewTimeoutOption(timeout time.Duration) TimeoutOption {
+	return TimeoutOption{timeout: timeout}
+}
+
+func (o TimeoutOption) applyCall(c *callOptions) {
+	c.timeout = &o.timeout
+}
+
+// TimeoutError is returned when an operation of the Repository exceeds its deadline, whether it is its own timeout or
+// the deadline of the caller's context. It keeps the gRPC status of the error it wraps.
+type TimeoutError struct {
+	// Operation is the name of the method of the Repository.
+	Operation string
+	// RowKey is the row key of the operation, or the first one when the operation spans several rows. For the scans, it
+	// is the first key of a bigtable.RowList or the description of the first bigtable.RowRange.
+	RowKey string
+	Err    error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Operation, e.RowKey, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus returns the status of the wrapped error, so that status.Code still reports codes.DeadlineExceeded.
+func (e *TimeoutError) GRPCStatus() *status.Status {
+	if s, ok := status.FromError(e.Err); ok {
+		return s
+	}
+	return status.New(codes.DeadlineExceeded, e.Err.Error())
+}
+
+type operationKind int
+
+const (
+	operationRead operationKind = iota
+	operationScan
+	operationWrite
+)
+
+/*
+startOperation derives the context of an operation from the timeout of the call, if any, or from the default timeout
+of the repository for this kind of operation.
+
+The returned function must be deferred with the address of the error of the operation: it releases the context and
+wraps a deadline error into a TimeoutError naming the operation and the row key.
+*/
+func (r *Repository) startOperation(ctx context.Context, kind operationKind, operation, key string, o *callOptions) (context.Context, func(*error)) {
+	return r.startOperationFunc(ctx, kind, operation, func() string { return key }, o)
+}
+
+// startScan is startOperation for the scans of a bigtable.RowSet, whose key is only computed when the scan times out.
+func (r *Repository) startScan(ctx context.Context, operation string, rowSet bigtable.RowSet, o *callOptions) (context.Context, func(*error)) {
+	return r.startOperationFunc(ctx, operationScan, operation, func() string { return rowSetKey(rowSet) }, o)
+}
+
+func (r *Repository) startOperationFunc(ctx context.Context, kind operationKind, operation string, key func() string, o *callOptions) (context.Context, func(*error)) {
+	timeout := r.timeouts.Read
+	switch kind {
+	case operationScan:
+		timeout = r.timeouts.Scan
+	case operationWrite:
+		timeout = r.timeouts.Write
+	}
+	if o != nil && o.timeout != nil {
+		timeout = *o.timeout
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func(err *error) {
+		cancel()
+		if *err != nil && errorCode(*err) == codes.DeadlineExceeded {
+			*err = &TimeoutError{Operation: operation, RowKey: key(), Err: *err}
+		}
+	}
+}
+
+// firstRowKey returns the lowest row key of the events of the data.Set.
+func firstRowKey(eventSet *data.Set) string {
+	first := ""
+	for _, events := range eventSet.Events {
+		for _, event := range events {
+			if first == "" || event.RowKey < first {
+				first = event.RowKey
+			}
+		}
+	}
+	return first
+}
+
+// rowSetKey names the bigtable.RowSet of a scan: the first key of a bigtable.RowList, the description of the first
+// bigtable.RowRange, or an empty string.
+func rowSetKey(rowSet bigtable.RowSet) string {
+	switch rs := rowSet.(type) {
+	case bigtable.RowList:
+		if len(rs) > 0 {
+			return rs[0]
+		}
+	case bigtable.RowRange:
+		return rs.String()
+	case bigtable.RowRangeList:
+		if len(rs) > 0 {
+			return rs[0].String()
+		}
+	}
+	return ""
+}
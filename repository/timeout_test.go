@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// slowAdapter takes delay to answer each call, unless the context is done before.
+type slowAdapter struct {
+	mockAdapter
+	delay time.Duration
+}
+
+func (a slowAdapter) wait(ctx context.Context) error {
+	return sleep(ctx, a.delay)
+}
+
+func (a slowAdapter) ReadRow(ctx context.Context, row string, opts ...bigtable.ReadOption) (bigtable.Row, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return a.mockAdapter.ReadRow(ctx, row, opts...)
+}
+
+func (a slowAdapter) ReadRows(ctx context.Context, arg bigtable.RowSet, f func(bigtable.Row) bool, opts ...bigtable.ReadOption) error {
+	if err := a.wait(ctx); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return a.mockAdapter.ReadRows(ctx, arg, f, opts...)
+}
+
+func (a slowAdapter) ApplyBulk(ctx context.Context, rowKeys []string, muts []*bigtable.Mutation, opts ...bigtable.ApplyOption) ([]error, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return a.mockAdapter.ApplyBulk(ctx, rowKeys, muts, opts...)
+}
+
+func TestRepository_Timeouts(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepositoryWithAdapter(slowAdapter{delay: 50 * time.Millisecond}, getMockMapper(t),
+		NewTimeoutsOption(Timeouts{Read: time.Millisecond, Scan: time.Millisecond, Write: time.Millisecond}))
+
+	_, err := repo.Read(ctx, "contact-1")
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Operation != "Read" || timeoutErr.RowKey != "contact-1" {
+		t.Fatalf("expected a TimeoutError of Read contact-1, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	_, err = repo.Search(ctx, bigtable.PrefixRange("contact-"), bigtable.PassAllFilter())
+	if !errors.As(err, &timeoutErr) || timeoutErr.Operation != "Search" || timeoutErr.RowKey != `["contact-","contact.")` {
+		t.Fatalf("expected a TimeoutError of Search [contact-,contact.), got %v", err)
+	}
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected the status of the wrapped error, got %s", status.Code(err))
+	}
+
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "contact-2", Date: time.Now(), Cells: map[string]string{"event_type": "page_view"}},
+			{RowKey: "contact-1", Date: time.Now(), Cells: map[string]string{"event_type": "page_view"}},
+		},
+	}}
+	_, err = repo.Write(ctx, eventSet)
+	if !errors.As(err, &timeoutErr) || timeoutErr.Operation != "Write" || timeoutErr.RowKey != "contact-1" {
+		t.Fatalf("expected a TimeoutError of Write contact-1, got %v", err)
+	}
+
+	// the timeout of the call overrides the default one, zero meaning no timeout
+	if _, err = repo.Read(ctx, "contact-1", NewTimeoutOption(0)); err != nil {
+		t.Fatalf("expected the read to succeed without timeout, got %v", err)
+	}
+	if _, err = repo.Search(ctx, bigtable.PrefixRange("contact-"), bigtable.PassAllFilter(), NewTimeoutOption(time.Second)); err != nil {
+		t.Fatalf("expected the search to succeed within its timeout, got %v", err)
+	}
+}
+
+func TestRepository_TimeoutOption(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepositoryWithAdapter(slowAdapter{delay: 50 * time.Millisecond}, getMockMapper(t))
+
+	if err := repo.DeleteRow(ctx, "contact-1"); err != nil {
+		t.Fatalf("expected no timeout by default, got %v", err)
+	}
+	err := repo.DeleteRow(ctx, "contact-1", NewTimeoutOption(time.Millisecond))
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Operation != "DeleteRow" || timeoutErr.RowKey != "contact-1" {
+		t.Fatalf("expected a TimeoutError of DeleteRow contact-1, got %v", err)
+	}
+
+	// the deadline of the caller is reported the same way
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	_, errs := repo.ReadMany(deadlineCtx, []string{"contact-1"})
+	if !errors.As(errs["contact-1"], &timeoutErr) || timeoutErr.Operation != "ReadMany" {
+		t.Fatalf("expected a TimeoutError of ReadMany, got %v", errs["contact-1"])
+	}
+
+	// the other errors are returned as they are
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = repo.Read(canceledCtx, "contact-1"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// WriteResult reports the rows that could not be written by a write operation along with the events they carried.
+type WriteResult struct {
+	Failures []*WriteFailure
+}
+
+// WriteFailure describes a row that could not be written.
+type WriteFailure struct {
+	RowKey string
+	// Events contains the events carried by the row, by column family.
+	Events map[string][]*data.Event
+	Err    error
+}
+
+// HasFailures reports whether at least one row could not be written.
+func (w *WriteResult) HasFailures() bool {
+	return w != nil && len(w.Failures) > 0
+}
+
+// Errors returns the errors of all the rows that could not be written.
+func (w *WriteResult) Errors() []error {
+	if w == nil {
+		return nil
+	}
+	errs := make([]error, 0, len(w.Failures))
+	for _, failure := range w.Failures {
+		errs = append(errs, failure.Err)
+	}
+	return errs
+}
+
+// FailedSet returns a data.Set containing only the events that could not be written, so it can be given back to Write to retry them.
+// It returns an empty data.Set for a nil WriteResult.
+func (w *WriteResult) FailedSet() *data.Set {
+	set := &data.Set{
+		Events:  make(map[string][]*data.Event),
+		Columns: make([]string, 0),
+	}
+	if w == nil {
+		return set
+	}
+	columns := make(map[string]bool)
+	for _, failure := range w.Failures {
+		for family, events := range failure.Events {
+			set.Events[family] = append(set.Events[family], events...)
+			for _, event := range events {
+				for column := range event.Cells {
+					columns[column] = true
+				}
+			}
+		}
+	}
+	for column := range columns {
+		set.Columns = append(set.Columns, column)
+	}
+	return set
+}
+
+// groupByRow groups the events of the data.Set by row key and then by column family.
+func groupByRow(eventSet *data.Set) map[string]map[string][]*data.Event {
+	rows := make(map[string]map[string][]*data.Event)
+	for family, events := range eventSet.Events {
+		for _, event := range events {
+			if _, ok := rows[event.RowKey]; !ok {
+				rows[event.RowKey] = make(map[string][]*data.Event)
+			}
+			rows[event.RowKey][family] = append(rows[event.RowKey][family], event)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/sendinblue/bigtable-access-layer/data"
+)
+
+// brokenBulkAdapter fails to write the row named "broken".
+type brokenBulkAdapter struct {
+	mockAdapter
+}
+
+func (a brokenBulkAdapter) ApplyBulk(_ context.Context, rowKeys []string, _ []*bigtable.Mutation, _ ...bigtable.ApplyOption) (errs []error, err error) {
+	errs = make([]error, len(rowKeys))
+	failed := false
+	for i, key := range rowKeys {
+		if key == "broken" {
+			errs[i] = errBrokenRow
+			failed = true
+		}
+	}
+	if !failed {
+		return nil, nil
+	}
+	return errs, nil
+}
+
+func TestRepository_WriteResult(t *testing.T) {
+	ctx := context.Background()
+	repository := &Repository{
+		adapter: brokenBulkAdapter{},
+		mapper:  getMockMapper(t),
+	}
+	eventSet := &data.Set{Events: map[string][]*data.Event{
+		"front": {
+			{RowKey: "contact-1", Date: time.Now(), Cells: map[string]string{"event_type": "page_view"}},
+			{RowKey: "broken", Date: time.Now(), Cells: map[string]string{"event_type": "page_view"}},
+			{RowKey: "broken", Date: time.Now().Add(time.Minute), Cells: map[string]string{"event_type": "purchase"}},
+		},
+		"blog": {
+			{RowKey: "broken", Date: time.Now(), Cells: map[string]string{"url": "https://example.org"}},
+			{RowKey: "contact-2", Date: time.Now(), Cells: map[string]string{"url": "https://example.org"}},
+		},
+	}}
+	result, err := repository.Write(ctx, eventSet)
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if !result.HasFailures() || len(result.Failures) != 1 {
+		t.Fatalf("expected 1 failure, got %d", len(result.Failures))
+	}
+	failure := result.Failures[0]
+	if failure.RowKey != "broken" || failure.Err != errBrokenRow {
+		t.Fatalf("unexpected failure %+v", failure)
+	}
+	if len(failure.Events["front"]) != 2 || len(failure.Events["blog"]) != 1 {
+		t.Fatalf("expected 2 front events and 1 blog event, got %d and %d", len(failure.Events["front"]), len(failure.Events["blog"]))
+	}
+
+	failedSet := result.FailedSet()
+	if len(failedSet.Events["front"]) != 2 || len(failedSet.Events["blog"]) != 1 {
+		t.Fatalf("expected 2 front events and 1 blog event, got %d and %d", len(failedSet.Events["front"]), len(failedSet.Events["blog"]))
+	}
+	for _, events := range failedSet.Events {
+		for _, event := range events {
+			if event.RowKey != "broken" {
+				t.Fatalf("unexpected event for row %s", event.RowKey)
+			}
+		}
+	}
+	if len(failedSet.Columns) != 2 {
+		t.Fatalf("expected 2 columns, got %v", failedSet.Columns)
+	}
+}
+
+func TestWriteResult_Nil(t *testing.T) {
+	var result *WriteResult
+	if result.HasFailures() || result.Errors() != nil {
+		t.Fatal("expected a nil result to have no failure")
+	}
+	if set := result.FailedSet(); set == nil || len(set.Events) != 0 {
+		t.Fatalf("expected an empty data.Set, got %v", set)
+	}
+}